@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/fhs/go-netrc/netrc"
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// defaultCredentialsFile is the credentials file which is used if it
+// exists and no other credentials are given.
+const defaultCredentialsFile = "credentials.dat"
+
+// githubTokenEnvVars are the environment variables which may hold a
+// token for github.com, in order of precedence.
+var githubTokenEnvVars = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+
+// enterpriseTokenEnvVars are the environment variables which may hold a
+// token for GitHub Enterprise, in order of precedence.
+var enterpriseTokenEnvVars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+
+// tokenEnvVars returns the environment variables which may hold a token
+// for a github API. The github.com token variables are only used for the
+// github.com API, so that the token isn't sent to any other host.
+func tokenEnvVars(apiURL string) []string {
+	if u, err := url.Parse(apiURL); err == nil && strings.EqualFold(u.Hostname(), "api.github.com") {
+		return githubTokenEnvVars
+	}
+	return enterpriseTokenEnvVars
+}
+
+// findAuth finds the credentials with which to authenticate to github.
+// The first of these which is available is used:
+//  1. The credentials file given by the --credentials option.
+//  2. A token in the GITHUB_TOKEN or GH_TOKEN environment variable for
+//     github.com, or GH_ENTERPRISE_TOKEN or GITHUB_ENTERPRISE_TOKEN for
+//     any other API host (see tokenEnvVars).
+//  3. The credentials.dat file in the working directory.
+//  4. The entry for the github API host (see --api-url) in the user's
+//     netrc file.
+func findAuth() (octokit.AuthMethod, error) {
+	if settings.Credentials != "" {
+		return getAuth(settings.Credentials)
+	}
+	for _, name := range tokenEnvVars(settings.apiURL()) {
+		if token := os.Getenv(name); token != "" {
+			return octokit.TokenAuth{AccessToken: token}, nil
+		}
+	}
+	if fileExists(defaultCredentialsFile) {
+		return getAuth(defaultCredentialsFile)
+	}
+	auth, err := netrcAuth(netrcFile(), settings.apiURL())
+	if err != nil {
+		return nil, withExitCode(exitAuthFailure, fmt.Errorf("no github credentials found (%v). "+
+			"Use --credentials, set %s, or create %s", err, tokenEnvVars(settings.apiURL())[0], defaultCredentialsFile))
+	}
+	return auth, nil
+}
+
+// netrcFile returns the path of the user's netrc file. This is given by
+// the NETRC environment variable, or defaults to .netrc (_netrc on
+// windows) in the user's home directory.
+func netrcFile() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name)
+}
+
+// netrcAuth reads the credentials for the host of an API URL from a
+// netrc file. The password is used as a github token.
+func netrcAuth(fileName, apiURL string) (octokit.AuthMethod, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	machine, err := netrc.FindMachine(fileName, u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	if machine.Password == "" {
+		return nil, fmt.Errorf("%s: no password for %s", fileName, u.Hostname())
+	}
+	return octokit.TokenAuth{AccessToken: machine.Password}, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+func TestFindAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		// credentials is the file given by --credentials, if any.
+		credentials string
+		env         map[string]string
+		// files are the files in the working directory.
+		files map[string]string
+		want  string // "" if no credentials should be found
+	}{
+		{"--credentials", "mine.dat", map[string]string{"GITHUB_TOKEN": "env"},
+			map[string]string{"mine.dat": "token=file", defaultCredentialsFile: "token=default"}, "file"},
+		{"missing --credentials", "missing.dat", map[string]string{"GITHUB_TOKEN": "env"}, nil, ""},
+		{"GITHUB_TOKEN", "", map[string]string{"GITHUB_TOKEN": "env", "GH_TOKEN": "other"},
+			map[string]string{defaultCredentialsFile: "token=default"}, "env"},
+		{"GH_TOKEN", "", map[string]string{"GH_TOKEN": "env"}, map[string]string{defaultCredentialsFile: "token=default"}, "env"},
+		{"credentials.dat", "", nil, map[string]string{defaultCredentialsFile: "token=default", "netrc": "machine api.github.com password netrc\n"}, "default"},
+		{"netrc", "", nil, map[string]string{"netrc": "machine api.github.com login me password netrc\n"}, "netrc"},
+		{"netrc for another host", "", nil, map[string]string{"netrc": "machine github.example.com login me password netrc\n"}, ""},
+		{"none", "", nil, nil, ""},
+	}
+	for _, test := range tests {
+		useTestSettings(t, githubAPIURL)
+		settings.Credentials = test.credentials
+		for name, contents := range test.files {
+			if err := os.WriteFile(name, []byte(contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		netrc, err := filepath.Abs("netrc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("NETRC", netrc)
+		for _, name := range githubTokenEnvVars {
+			t.Setenv(name, test.env[name])
+		}
+
+		auth, err := findAuth()
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: got credentials %v, want none", test.name, auth)
+			} else if exitCode(err) != exitAuthFailure {
+				t.Errorf("%s: got exit code %d, want %d", test.name, exitCode(err), exitAuthFailure)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if token, ok := auth.(octokit.TokenAuth); !ok || token.AccessToken != test.want {
+			t.Errorf("%s: got credentials %v, want token %s", test.name, auth, test.want)
+		}
+	}
+}
+
+func TestFindAuthTokenHost(t *testing.T) {
+	tests := []struct {
+		apiURL string
+		env    map[string]string
+		want   string // "" if no credentials should be found
+	}{
+		{githubAPIURL, map[string]string{"GITHUB_TOKEN": "public"}, "public"},
+		{githubAPIURL, map[string]string{"GH_TOKEN": "public"}, "public"},
+		{githubAPIURL, map[string]string{"GH_ENTERPRISE_TOKEN": "enterprise"}, ""},
+		{"https://github.example.com/api/v3", map[string]string{"GITHUB_TOKEN": "public", "GH_TOKEN": "public"}, ""},
+		{"https://github.example.com/api/v3", map[string]string{"GITHUB_TOKEN": "public", "GH_ENTERPRISE_TOKEN": "enterprise"}, "enterprise"},
+		{"https://github.example.com/api/v3", map[string]string{"GITHUB_ENTERPRISE_TOKEN": "enterprise"}, "enterprise"},
+	}
+	for _, test := range tests {
+		useTestSettings(t, test.apiURL)
+		t.Setenv("NETRC", filepath.Join(t.TempDir(), "missing"))
+		for _, name := range append(githubTokenEnvVars, enterpriseTokenEnvVars...) {
+			t.Setenv(name, test.env[name])
+		}
+
+		auth, err := findAuth()
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s with %v: got credentials %v, want none", test.apiURL, test.env, auth)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s with %v: %v", test.apiURL, test.env, err)
+		} else if token, ok := auth.(octokit.TokenAuth); !ok || token.AccessToken != test.want {
+			t.Errorf("%s with %v: got credentials %v, want token %s", test.apiURL, test.env, auth, test.want)
+		}
+	}
+}
+
+func TestFindAuthNetrcHost(t *testing.T) {
+	useTestSettings(t, "https://github.example.com/api/v3")
+	for _, name := range append(githubTokenEnvVars, enterpriseTokenEnvVars...) {
+		t.Setenv(name, "")
+	}
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	err := os.WriteFile(netrc, []byte("machine api.github.com login me password public\n"+
+		"machine github.example.com login me password enterprise\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", netrc)
+
+	auth, err := findAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, ok := auth.(octokit.TokenAuth); !ok || token.AccessToken != "enterprise" {
+		t.Errorf("got credentials %v, want the token for github.example.com", auth)
+	}
+}
@@ -22,13 +22,17 @@ func (S barSeries) Value(index int) float64 {
 	return S.Values[index]
 }
 
-func barSeriesFromGroups(name string, groups map[string][]octokit.Issue) barSeries {
+// barSeriesFromGroups creates a bar series containing the number of
+// issues in each group, for a given list of group names. The bars are in
+// the same order as the names, so that series created from the same list
+// of names may be stacked on one another.
+func barSeriesFromGroups(name string, groups map[string][]octokit.Issue, names []string) barSeries {
 	series := barSeries{}
 	series.Name = name
 
-	for user, issues := range groups {
+	for _, user := range names {
 		series.Names = append(series.Names, user)
-		series.Values = append(series.Values, float64(len(issues)))
+		series.Values = append(series.Values, float64(len(groups[user])))
 	}
 
 	return series
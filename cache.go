@@ -1,95 +1,537 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/octokit/go-octokit/octokit"
 )
 
-// writeIssuesToCache serialises an array of issues and writes them to
-// a json text file.
-func writeIssuesToCache(fileName string, issues []octokit.Issue) {
-	f, err := os.Create(fileName)
+// cacheFileName returns the name of the cache file which holds a given
+// kind of data (e.g. issuesCache) for a github repository.
+func cacheFileName(owner, repo, kind string) string {
+	return fmt.Sprintf(".%s.%s.%s", owner, repo, kind)
+}
+
+// legacyCacheRepository is the repository whose data is held by the
+// cache files written before the repository could be chosen, which
+// weren't named after it (see legacyCacheFiles).
+var legacyCacheRepository = repository{Owner: "APSIMInitiative", Name: "ApsimX"}
+
+// legacyCacheFiles maps each kind of cache file to the name of the file
+// which held it before the repository could be chosen.
+var legacyCacheFiles = map[string]string{
+	issuesCache: ".issues.cache",
+	pullsCache:  ".pulls.cache",
+}
+
+// migrateLegacyCache renames the cache files written before the
+// repository could be chosen to the names used for a repository, if
+// these files hold its data and it has no cache files of its own. They
+// are then read like any other cache files written by older versions.
+func migrateLegacyCache(repo repository) error {
+	if !strings.EqualFold(repo.String(), legacyCacheRepository.String()) {
+		return nil
+	}
+	kinds := []string{issuesCache, pullsCache}
+	for _, kind := range kinds {
+		if !fileExists(legacyCacheFiles[kind]) || fileExists(cacheFileName(repo.Owner, repo.Name, kind)) {
+			return nil
+		}
+	}
+	for _, kind := range kinds {
+		fileName := cacheFileName(repo.Owner, repo.Name, kind)
+		if err := os.Rename(legacyCacheFiles[kind], fileName); err != nil {
+			return cacheError(legacyCacheFiles[kind], err)
+		}
+		if !settings.Quiet {
+			fmt.Printf("Renamed %s to %s\n", legacyCacheFiles[kind], fileName)
+		}
+	}
+	return nil
+}
+
+// cacheMetadata holds information about the cached data for a
+// repository.
+type cacheMetadata struct {
+	// LastSync is the time at which data was last fetched from github.
+	LastSync time.Time `json:"last_sync"`
+	// APIURL is the base URL of the github API from which the data was
+	// fetched. Empty for data fetched from github.com by older versions.
+	APIURL string `json:"api_url,omitempty"`
+}
+
+// defaultAPIURL returns the API URL recorded in a cache or checkpoint
+// file. Files written before the API URL was recorded contain data from
+// github.com.
+func defaultAPIURL(apiURL string) string {
+	if apiURL == "" {
+		return githubAPIURL
+	}
+	return apiURL
+}
+
+// cachedAPIURL returns the base URL of the github API from which the
+// data in the cache was fetched.
+func cachedAPIURL(metadataFile string) (string, error) {
+	if !fileExists(metadataFile) {
+		return githubAPIURL, nil
+	}
+	metadata, err := metadataFromCache(metadataFile)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	defer f.Close()
-	encoder := json.NewEncoder(f)
-	encoder.Encode(issues)
+	return defaultAPIURL(metadata.APIURL), nil
 }
 
-// writeToCache serialises the array of pull requests and writes them
-// to a json text file.
-func writeToCache(fileName string, data []octokit.PullRequest) {
+// cacheError attaches the cache failure exit code to an error which
+// occurred while reading or writing a cache file.
+// Returns nil if err is nil.
+func cacheError(fileName string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return withExitCode(exitCacheFailure, fmt.Errorf("cache file '%s': %w", fileName, err))
+}
+
+// writeJSONToCache serialises a value and writes it to a json text
+// file. The file is replaced atomically, so that it is never left
+// incomplete if the program is interrupted: the value is written to a
+// temporary file, which is flushed to disk and checked, and then renamed
+// over the file. The previous version of the file is kept as a backup
+// (see backupFileName).
+func writeJSONToCache(fileName string, data interface{}) error {
+	tempFile := tempFileName(fileName)
+	if err := writeJSONFile(tempFile, data); err != nil {
+		os.Remove(tempFile)
+		return cacheError(fileName, err)
+	}
+	if err := verifyJSONFile(tempFile, data); err != nil {
+		os.Remove(tempFile)
+		return cacheError(fileName, fmt.Errorf("data written to %s is invalid: %w", tempFile, err))
+	}
+	if fileExists(fileName) {
+		if err := backupFile(fileName, backupFileName(fileName)); err != nil {
+			os.Remove(tempFile)
+			return cacheError(fileName, err)
+		}
+	}
+	if err := os.Rename(tempFile, fileName); err != nil {
+		os.Remove(tempFile)
+		return cacheError(fileName, err)
+	}
+	syncDir(filepath.Dir(fileName))
+	return nil
+}
+
+// tempFileName returns the name of the temporary file to which a cache
+// file is written before it is replaced.
+func tempFileName(fileName string) string {
+	return fileName + ".tmp"
+}
+
+// backupFileName returns the name of the file which holds the previous
+// version of a cache file.
+func backupFileName(fileName string) string {
+	return fileName + ".bak"
+}
+
+// writeJSONFile serialises a value to a json text file, which is
+// compressed if the user has asked for compressed caches, and flushes
+// the file to disk.
+func writeJSONFile(fileName string, data interface{}) error {
 	f, err := os.Create(fileName)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	w := cacheWriter(f)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		w.Close()
+		f.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
 	}
-	defer f.Close()
-	encoder := json.NewEncoder(f)
-	encoder.Encode(data)
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
-// issuesFromCache reads an array of octokit issues from a json text
-// file.
-func issuesFromCache(fileName string) []octokit.Issue {
-	f, err := os.Open(fileName)
+// verifyJSONFile checks that a json text file holding data can be read
+// back in the same way as the cache is read: via readCache for cache
+// files, which must hold all of the items written, and via
+// metadataFromCache for metadata.
+func verifyJSONFile(fileName string, data interface{}) error {
+	switch data := data.(type) {
+	case cacheFile:
+		repo, err := parseRepository(data.Repository)
+		if err != nil {
+			return err
+		}
+		items := reflect.New(reflect.TypeOf(data.Items))
+		if _, err := readCache(fileName, data.Kind, repo, data.FetchedAt, items.Interface()); err != nil {
+			return err
+		}
+		if count, written := items.Elem().Len(), reflect.ValueOf(data.Items).Len(); count != written {
+			return fmt.Errorf("holds %d items, but %d were written", count, written)
+		}
+		return nil
+	case cacheMetadata:
+		metadata, err := metadataFromCache(fileName)
+		if err != nil {
+			return err
+		}
+		if !metadata.LastSync.Equal(data.LastSync) || metadata.APIURL != data.APIURL {
+			return fmt.Errorf("holds different metadata from that written")
+		}
+		return nil
+	}
+	return fmt.Errorf("can't verify a cache file holding %T", data)
+}
+
+// backupFile replaces a backup file with a copy of a file. The copy is a
+// hard link where possible.
+func backupFile(fileName, backup string) error {
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(fileName, backup) == nil {
+		return nil
+	}
+	contents, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer f.Close()
-	decoder := json.NewDecoder(f)
+	return ioutil.WriteFile(backup, contents, 0644)
+}
 
-	// Read opening brace.
-	_, err = decoder.Token()
+// syncDir flushes a directory to disk, so that files renamed within it
+// are not lost if the system crashes. This isn't supported on all
+// platforms, so errors are ignored.
+func syncDir(dir string) {
+	f, err := os.Open(dir)
 	if err != nil {
-		panic(err)
+		return
 	}
+	f.Sync()
+	f.Close()
+}
 
-	// Deserialise each value in the array.
-	var issues []octokit.Issue
-	for decoder.More() {
-		var issue octokit.Issue
-		err := decoder.Decode(&issue)
-		if err != nil {
-			panic(err)
+// cacheSchemaVersion is the version of the format of the issues, pulls
+// and links cache files. Increment it whenever the format changes, and
+// migrate files in the older format in readCache.
+//
+// Version history:
+//   - 0: a bare json array of items.
+//   - 1: a json object holding a header (see cacheHeader) and the items.
+const cacheSchemaVersion = 1
+
+// cacheHeader describes the contents of a cache file.
+type cacheHeader struct {
+	// SchemaVersion is the version of the format of the file.
+	SchemaVersion int `json:"schema_version"`
+	// Kind is the kind of data in the file (e.g. issuesCache).
+	Kind string `json:"kind"`
+	// Repository is the full name (owner/repo) of the repository to which
+	// the data belongs.
+	Repository string `json:"repository"`
+	// APIURL is the base URL of the github API from which the data was
+	// fetched.
+	APIURL string `json:"api_url"`
+	// FetchedAt is the time at which data was last fetched from github.
+	// This is also recorded as the last sync in the cache metadata, and
+	// the two are checked against each other when the file is read (see
+	// writtenAt).
+	FetchedAt time.Time `json:"fetched_at"`
+	// LastUpdated is the latest time at which any of the items was
+	// updated. Zero for links, which have no update time.
+	LastUpdated time.Time `json:"last_updated"`
+	// Count is the number of items in the file.
+	Count int `json:"count"`
+	// Stripped is set if the fields of the items which aren't used by
+	// this program were removed (see --strip-fields).
+	Stripped bool `json:"stripped,omitempty"`
+}
+
+// writtenAt checks if a cache file was written by the fetch at a given
+// time (e.g. the last sync recorded in the cache metadata). If not, the
+// program was interrupted while writing the cache, or some of the cache
+// files were replaced. Files in the original format (version 0) don't
+// record the time of the fetch, so they are assumed to match.
+func (h cacheHeader) writtenAt(fetchedAt time.Time) bool {
+	return h.SchemaVersion == 0 || h.FetchedAt.Equal(fetchedAt)
+}
+
+// newCacheHeader creates the header of the cache files for data fetched
+// from a repository at a given time.
+func newCacheHeader(repo repository, fetchedAt time.Time) cacheHeader {
+	return cacheHeader{
+		SchemaVersion: cacheSchemaVersion,
+		Repository:    repo.String(),
+		APIURL:        settings.apiURL(),
+		FetchedAt:     fetchedAt,
+		Stripped:      settings.StripFields,
+	}
+}
+
+// cacheFile is the layout of a cache file: a header followed by the
+// items.
+type cacheFile struct {
+	cacheHeader
+	Items interface{} `json:"items"`
+}
+
+// writeIssuesToCache serialises an array of issues and writes them to
+// a json text file.
+func writeIssuesToCache(fileName string, header cacheHeader, issues []octokit.Issue) error {
+	header.Kind = issuesCache
+	header.Count = len(issues)
+	for _, issue := range issues {
+		if issue.UpdatedAt.After(header.LastUpdated) {
+			header.LastUpdated = issue.UpdatedAt
 		}
-		issues = append(issues, issue)
 	}
-	return issues
+	if header.Stripped {
+		stripped := make([]octokit.Issue, len(issues))
+		for i, issue := range issues {
+			stripped[i] = stripIssue(issue)
+		}
+		issues = stripped
+	}
+	return writeJSONToCache(fileName, cacheFile{header, issues})
 }
 
-// pullsFromCache reads an array of pull requests from a json text
-// file.
-func pullsFromCache(fileName string) []octokit.PullRequest {
-	f, err := os.Open(fileName)
+// writeToCache serialises the array of pull requests and writes them
+// to a json text file.
+func writeToCache(fileName string, header cacheHeader, data []octokit.PullRequest) error {
+	header.Kind = pullsCache
+	header.Count = len(data)
+	for _, pull := range data {
+		if pull.UpdatedAt.After(header.LastUpdated) {
+			header.LastUpdated = pull.UpdatedAt
+		}
+	}
+	if header.Stripped {
+		stripped := make([]octokit.PullRequest, len(data))
+		for i, pull := range data {
+			stripped[i] = stripPull(pull)
+		}
+		data = stripped
+	}
+	return writeJSONToCache(fileName, cacheFile{header, data})
+}
+
+// readCache reads a cache file holding a given kind of data for a
+// repository, and decodes its items into items, which must be a pointer
+// to a slice. Compressed files are detected automatically. Files in an
+// older format are migrated as they are read.
+// Files in a newer format, or holding the wrong data, are refused. If
+// lastSync is not the zero time, files which weren't written by the
+// fetch at that time (see writtenAt) are refused too.
+func readCache(fileName, kind string, repo repository, lastSync time.Time, items interface{}) (cacheHeader, error) {
+	contents, err := readCacheFile(fileName)
 	if err != nil {
-		panic(err)
+		return cacheHeader{}, cacheError(fileName, err)
 	}
-	defer f.Close()
-	decoder := json.NewDecoder(f)
 
-	// Read opening brace.
-	_, err = decoder.Token()
+	// Version 0 files hold a bare array of items. They are rewritten in
+	// the current format the next time the data is fetched.
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("[")) {
+		header := cacheHeader{Kind: kind, Repository: repo.String()}
+		if err := json.Unmarshal(contents, items); err != nil {
+			return header, cacheError(fileName, err)
+		}
+		header.Count = reflect.ValueOf(items).Elem().Len()
+		return header, nil
+	}
+
+	var file struct {
+		cacheHeader
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return file.cacheHeader, cacheError(fileName, err)
+	}
+	header := file.cacheHeader
+	switch {
+	case header.SchemaVersion > cacheSchemaVersion:
+		err = fmt.Errorf("schema version %d is newer than the latest version supported by this program (%d); "+
+			"upgrade, or run the fetch command to replace the cache", header.SchemaVersion, cacheSchemaVersion)
+	case header.SchemaVersion < 1:
+		err = fmt.Errorf("not a cache file (no schema version)")
+	case header.Kind != kind:
+		err = fmt.Errorf("holds %s data, not %s", header.Kind, kind)
+	case !strings.EqualFold(header.Repository, repo.String()):
+		err = fmt.Errorf("holds data for %s, not %s", header.Repository, repo)
+	case !lastSync.IsZero() && !header.writtenAt(lastSync):
+		err = fmt.Errorf("was written by the fetch at %s, but the last sync was at %s, so the cache is incomplete; "+
+			"run the fetch command to replace it", header.FetchedAt.Local().Format(time.RFC1123), lastSync.Local().Format(time.RFC1123))
+	}
 	if err != nil {
-		panic(err)
+		return header, cacheError(fileName, err)
+	}
+	if err := json.Unmarshal(file.Items, items); err != nil {
+		return header, cacheError(fileName, err)
+	}
+	if count := reflect.ValueOf(items).Elem().Len(); count != header.Count {
+		return header, cacheError(fileName, fmt.Errorf("holds %d items, but %d were written; the file is incomplete", count, header.Count))
 	}
+	return header, nil
+}
 
-	// Deserialise each value in the array.
+// readCacheHeader reads the header of a cache file holding a given kind
+// of data for a repository.
+func readCacheHeader(fileName, kind string, repo repository) (cacheHeader, error) {
+	var items []json.RawMessage
+	return readCache(fileName, kind, repo, time.Time{}, &items)
+}
+
+// issuesFromCache reads an array of octokit issues from a json text
+// file, which must have been written at lastSync (see readCache).
+func issuesFromCache(fileName string, repo repository, lastSync time.Time) ([]octokit.Issue, error) {
+	var issues []octokit.Issue
+	_, err := readCache(fileName, issuesCache, repo, lastSync, &issues)
+	return issues, err
+}
+
+// pullsFromCache reads an array of pull requests from a json text
+// file, which must have been written at lastSync (see readCache).
+func pullsFromCache(fileName string, repo repository, lastSync time.Time) ([]octokit.PullRequest, error) {
 	var pulls []octokit.PullRequest
-	for decoder.More() {
-		var pull octokit.PullRequest
-		err := decoder.Decode(&pull)
-		if err != nil {
-			panic(err)
-		}
+	_, err := readCache(fileName, pullsCache, repo, lastSync, &pulls)
+	return pulls, err
+}
+
+// getDataFromCache gets all issues and pull requests for a repository
+// from the cache, which must have been written at lastSync (see
+// readCache).
+func getDataFromCache(issuesCache, pullsCache string, repo repository, lastSync time.Time) ([]octokit.Issue, []octokit.PullRequest, error) {
+	issues, err := issuesFromCache(issuesCache, repo, lastSync)
+	if err != nil {
+		return nil, nil, err
+	}
+	pulls, err := pullsFromCache(pullsCache, repo, lastSync)
+	if err != nil {
+		return nil, nil, err
+	}
+	return issues, pulls, nil
+}
+
+// writeMetadataToCache serialises cache metadata and writes it to a
+// json text file.
+func writeMetadataToCache(fileName string, metadata cacheMetadata) error {
+	return writeJSONToCache(fileName, metadata)
+}
+
+// metadataFromCache reads cache metadata from a json text file.
+func metadataFromCache(fileName string) (cacheMetadata, error) {
+	var metadata cacheMetadata
+	contents, err := readCacheFile(fileName)
+	if err != nil {
+		return metadata, cacheError(fileName, err)
+	}
+	err = json.Unmarshal(contents, &metadata)
+	if err != nil {
+		return metadata, cacheError(fileName, err)
+	}
+	return metadata, nil
+}
+
+// mergeIssues merges updated issues into an array of cached issues.
+// Cached issues are replaced by the updated issue with the same number.
+// The result is sorted by issue number in descending order, which is
+// the order in which github returns them.
+func mergeIssues(cached, updated []octokit.Issue) []octokit.Issue {
+	byNumber := make(map[int]octokit.Issue)
+	for _, issue := range cached {
+		byNumber[issue.Number] = issue
+	}
+	for _, issue := range updated {
+		byNumber[issue.Number] = issue
+	}
+
+	issues := make([]octokit.Issue, 0, len(byNumber))
+	for _, issue := range byNumber {
+		issues = append(issues, issue)
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Number > issues[j].Number })
+	return issues
+}
+
+// mergePullRequests merges updated pull requests into an array of
+// cached pull requests. Cached pull requests are replaced by the updated
+// pull request with the same number. The result is sorted by number in
+// descending order, which is the order in which github returns them.
+func mergePullRequests(cached, updated []octokit.PullRequest) []octokit.PullRequest {
+	byNumber := make(map[int]octokit.PullRequest)
+	for _, pull := range cached {
+		byNumber[pull.Number] = pull
+	}
+	for _, pull := range updated {
+		byNumber[pull.Number] = pull
+	}
+
+	pulls := make([]octokit.PullRequest, 0, len(byNumber))
+	for _, pull := range byNumber {
 		pulls = append(pulls, pull)
 	}
+	sort.Slice(pulls, func(i, j int) bool { return pulls[i].Number > pulls[j].Number })
 	return pulls
 }
 
-// getDataFromCache gets all issues and pull requests from the cache.
-func getDataFromCache(issuesCache, pullsCache string) ([]octokit.Issue, []octokit.PullRequest) {
-	return issuesFromCache(issuesCache), pullsFromCache(pullsCache)
+// writeLinksToCache serialises an array of issue links and writes them
+// to a json text file.
+func writeLinksToCache(fileName string, header cacheHeader, links []issueLink) error {
+	header.Kind = linksCache
+	header.Count = len(links)
+	return writeJSONToCache(fileName, cacheFile{header, links})
+}
+
+// linksFromCache reads an array of issue links from a json text file,
+// which must have been written at lastSync (see readCache).
+func linksFromCache(fileName string, repo repository, lastSync time.Time) ([]issueLink, error) {
+	var links []issueLink
+	_, err := readCache(fileName, linksCache, repo, lastSync, &links)
+	return links, err
+}
+
+// mergeLinks merges the links fetched with a set of updated issues and
+// pull requests into an array of cached links. Cached links which were
+// derived from an updated issue or pull request are replaced by the
+// updated links.
+func mergeLinks(cached, updated []issueLink, issues []octokit.Issue, pulls []octokit.PullRequest) []issueLink {
+	updatedIssues := make(map[string]bool)
+	for _, issue := range issues {
+		updatedIssues[pullKey(issueRepository(issue), issue.Number)] = true
+	}
+	updatedPulls := make(map[string]bool)
+	for _, pull := range pulls {
+		updatedPulls[pullKey(pullRepository(pull), pull.Number)] = true
+	}
+
+	var links []issueLink
+	for _, link := range cached {
+		issue := pullKey(link.IssueRepo, link.Issue)
+		pull := pullKey(link.PullRepo, link.Pull)
+		if link.Source == linkFromClosedEvent && updatedIssues[issue] {
+			continue
+		}
+		if link.Source == linkFromClosingReference && updatedPulls[pull] {
+			continue
+		}
+		links = append(links, link)
+	}
+	return append(links, updated...)
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// useTestSettings sets the options for the duration of a test, and
+// changes to a temporary directory in which the cache, checkpoint and
+// page cache files are written.
+func useTestSettings(t *testing.T, apiURL string) {
+	t.Helper()
+	saved := settings
+	t.Cleanup(func() { settings = saved })
+	settings = options{APIURL: apiURL, Quiet: true, Workers: 2, MaxRetries: 3}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func testIssue(number int) octokit.Issue {
+	return octokit.Issue{Number: number, Title: fmt.Sprintf("Issue %d", number), State: "open"}
+}
+
+func TestMigrateLegacyCache(t *testing.T) {
+	tests := []struct {
+		name string
+		repo repository
+		// The cache files which exist before the migration.
+		legacy, own []string
+		// renamed is set if the legacy files are expected to be renamed.
+		renamed bool
+	}{
+		{"legacy cache", legacyCacheRepository, []string{issuesCache, pullsCache}, nil, true},
+		{"repository name in another case", repository{"apsiminitiative", "apsimx"}, []string{issuesCache, pullsCache}, nil, true},
+		{"another repository", repository{"owner", "repo"}, []string{issuesCache, pullsCache}, nil, false},
+		{"existing cache", legacyCacheRepository, []string{issuesCache, pullsCache}, []string{issuesCache}, false},
+		{"incomplete legacy cache", legacyCacheRepository, []string{issuesCache}, nil, false},
+		{"no legacy cache", legacyCacheRepository, nil, nil, false},
+	}
+	for _, test := range tests {
+		useTestSettings(t, githubAPIURL)
+		for _, kind := range test.legacy {
+			if err := ioutil.WriteFile(legacyCacheFiles[kind], []byte("[]"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, kind := range test.own {
+			if err := ioutil.WriteFile(cacheFileName(test.repo.Owner, test.repo.Name, kind), []byte("[]"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := migrateLegacyCache(test.repo); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, kind := range test.legacy {
+			if renamed := !fileExists(legacyCacheFiles[kind]); renamed != test.renamed {
+				t.Errorf("%s: %s renamed = %v, want %v", test.name, legacyCacheFiles[kind], renamed, test.renamed)
+			}
+			if test.renamed && !fileExists(cacheFileName(test.repo.Owner, test.repo.Name, kind)) {
+				t.Errorf("%s: %s was renamed, but not to %s", test.name, legacyCacheFiles[kind], cacheFileName(test.repo.Owner, test.repo.Name, kind))
+			}
+		}
+	}
+}
+
+func TestMergeIssues(t *testing.T) {
+	updated := testIssue(2)
+	updated.State = "closed"
+	tests := []struct {
+		cached, updated []octokit.Issue
+		// want lists the numbers and states of the merged issues.
+		want string
+	}{
+		{nil, nil, "[]"},
+		{[]octokit.Issue{testIssue(2), testIssue(1)}, nil, "[2 open 1 open]"},
+		{nil, []octokit.Issue{testIssue(1), testIssue(2)}, "[2 open 1 open]"},
+		{[]octokit.Issue{testIssue(3), testIssue(2), testIssue(1)}, []octokit.Issue{updated}, "[3 open 2 closed 1 open]"},
+		{[]octokit.Issue{testIssue(2), testIssue(1)}, []octokit.Issue{testIssue(4), updated}, "[4 open 2 closed 1 open]"},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, issue := range mergeIssues(test.cached, test.updated) {
+			got = append(got, fmt.Sprint(issue.Number, " ", issue.State))
+		}
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("mergeIssues(%v, %v) = %v, want %s", issueNumbers(test.cached), issueNumbers(test.updated), got, test.want)
+		}
+	}
+}
+
+func TestMergePullRequests(t *testing.T) {
+	pull := func(number int, state string) octokit.PullRequest {
+		return octokit.PullRequest{Number: number, State: state}
+	}
+	tests := []struct {
+		cached, updated []octokit.PullRequest
+		// want lists the numbers and states of the merged pull requests.
+		want string
+	}{
+		{nil, nil, "[]"},
+		{[]octokit.PullRequest{pull(1, "open")}, []octokit.PullRequest{pull(1, "closed")}, "[1 closed]"},
+		{[]octokit.PullRequest{pull(3, "open"), pull(1, "open")}, []octokit.PullRequest{pull(2, "open"), pull(1, "closed")}, "[3 open 2 open 1 closed]"},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, pull := range mergePullRequests(test.cached, test.updated) {
+			got = append(got, fmt.Sprint(pull.Number, " ", pull.State))
+		}
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("mergePullRequests(%v, %v) = %v, want %s", test.cached, test.updated, got, test.want)
+		}
+	}
+}
+
+// writeTestCache writes the cache files for a repository, as if it had
+// been fetched at a given time and held the given issues.
+func writeTestCache(t *testing.T, repo repository, fetchedAt time.Time, issues ...octokit.Issue) {
+	t.Helper()
+	header := newCacheHeader(repo, fetchedAt)
+	if err := writeIssuesToCache(cacheFileName(repo.Owner, repo.Name, issuesCache), header, issues); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeToCache(cacheFileName(repo.Owner, repo.Name, pullsCache), header, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeLinksToCache(cacheFileName(repo.Owner, repo.Name, linksCache), header, nil); err != nil {
+		t.Fatal(err)
+	}
+	metadata := cacheMetadata{LastSync: fetchedAt, APIURL: settings.apiURL()}
+	if err := writeMetadataToCache(cacheFileName(repo.Owner, repo.Name, metadataCache), metadata); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteIssuesToCache(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	repo := repository{Owner: "owner", Name: "repo"}
+	fileName := filepath.Join(t.TempDir(), "issues.json")
+	fetchedAt := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
+	issues := []octokit.Issue{testIssue(2), testIssue(1)}
+	if err := writeIssuesToCache(fileName, newCacheHeader(repo, fetchedAt), issues); err != nil {
+		t.Fatal(err)
+	}
+	got, err := issuesFromCache(fileName, repo, fetchedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Number != 2 || got[1].Number != 1 {
+		t.Errorf("got issues %v, want [2 1]", issueNumbers(got))
+	}
+	if _, err := os.Stat(tempFileName(fileName)); !os.IsNotExist(err) {
+		t.Errorf("the temporary file was left behind (%v)", err)
+	}
+
+	// Files written by another fetch, or for another repository, are
+	// refused.
+	if _, err := issuesFromCache(fileName, repo, fetchedAt.Add(time.Hour)); exitCode(err) != exitCacheFailure {
+		t.Errorf("file written by another fetch: got %v, want a cache failure", err)
+	}
+	if _, err := issuesFromCache(fileName, repository{Owner: "owner", Name: "other"}, fetchedAt); exitCode(err) != exitCacheFailure {
+		t.Errorf("file for another repository: got %v, want a cache failure", err)
+	}
+}
+
+func TestVerifyJSONFile(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	repo := repository{Owner: "owner", Name: "repo"}
+	fetchedAt := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
+	header := newCacheHeader(repo, fetchedAt)
+	header.Kind = issuesCache
+	header.Count = 1
+	file := cacheFile{header, []octokit.Issue{testIssue(1)}}
+	fileName := filepath.Join(t.TempDir(), "issues.json")
+	if err := writeJSONFile(fileName, file); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyJSONFile(fileName, file); err != nil {
+		t.Errorf("a complete file is invalid: %v", err)
+	}
+
+	// A file which can be deserialised, but which readCache refuses, is
+	// invalid.
+	if err := writeJSONFile(fileName, cacheFile{header, []octokit.Issue{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyJSONFile(fileName, file); err == nil {
+		t.Error("a file with missing items is valid")
+	}
+
+	metadata := cacheMetadata{LastSync: fetchedAt, APIURL: githubAPIURL}
+	if err := writeJSONFile(fileName, cacheMetadata{LastSync: fetchedAt.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyJSONFile(fileName, metadata); err == nil {
+		t.Error("a metadata file holding a different last sync is valid")
+	}
+}
+
+func TestRestoreBackups(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	repo := repository{Owner: "owner", Name: "repo"}
+	restore := func(kinds ...string) {
+		for _, kind := range kinds {
+			fileName := cacheFileName("owner", "repo", kind)
+			if err := os.Rename(backupFileName(fileName), fileName); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeTestCache(t, repo, date(2025, 7, 1), testIssue(1))
+	writeTestCache(t, repo, date(2025, 7, 2), testIssue(1), testIssue(2))
+
+	// A single backup doesn't match the metadata.
+	restore(issuesCache)
+	if _, _, _, err := readCachedData(repo); err == nil {
+		t.Error("a single restored backup was read")
+	}
+
+	restore(pullsCache, linksCache, metadataCache)
+	issues, _, _, err := readCachedData(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(issueNumbers(issues)) != "[1]" {
+		t.Errorf("got issues %v from the backups, want [1]", issueNumbers(issues))
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// maxCheckpointAge is the age after which a checkpoint is no longer
+// resumed. Items may have been updated since the pages in an older
+// checkpoint were fetched, so it's better to fetch them again.
+const maxCheckpointAge = 24 * time.Hour
+
+// checkpointPage is a page of results which has been fetched from
+// github. Pages are appended to a checkpoint file as they are fetched,
+// so that an interrupted fetch can be resumed.
+type checkpointPage struct {
+	// Since is the time from which updated items were being fetched
+	// (zero for a full fetch). A checkpoint is only resumed by a fetch
+	// with the same since time.
+	Since time.Time `json:"since"`
+	// APIURL is the base URL of the github API from which the page was
+	// fetched. A checkpoint is only resumed by a fetch from the same
+	// API. Empty for pages fetched from github.com by older versions.
+	APIURL string `json:"api_url,omitempty"`
+	// FetchedAt is the time at which the request for the page was sent.
+	// Zero for pages fetched by older versions, which are never resumed.
+	FetchedAt time.Time `json:"fetched_at"`
+
+	// Page is the page number, starting from 1.
+	Page int `json:"page"`
+	// NumPages is the total number of pages.
+	NumPages int `json:"num_pages"`
+	// LastPageURL is the URL of the last page (only recorded on the
+	// first page). It is used to construct the URLs of the other pages.
+	LastPageURL string `json:"last_page_url,omitempty"`
+	// Done indicates that no pages after this one are required.
+	Done bool `json:"done,omitempty"`
+
+	Issues []octokit.Issue       `json:"issues,omitempty"`
+	Pulls  []octokit.PullRequest `json:"pulls,omitempty"`
+}
+
+// readCheckpoint reads all pages from a checkpoint file. Returns nil if
+// the file does not exist, or if it was written by a fetch with a
+// different since time or API URL, or by an older version which didn't
+// record when pages were fetched. A partially written page at the end
+// of the file (e.g. if the program was killed while writing it) is
+// ignored.
+func readCheckpoint(fileName string, since time.Time, apiURL string) []checkpointPage {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var pages []checkpointPage
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// Either EOF, or a page without a trailing newline, which
+			// must not have been completely written.
+			break
+		}
+		var page checkpointPage
+		if json.Unmarshal(line, &page) != nil {
+			break
+		}
+		if !page.Since.Equal(since) || defaultAPIURL(page.APIURL) != apiURL || page.Page < 1 || page.FetchedAt.IsZero() {
+			return nil
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// resumeCheckpoints prepares to resume a fetch from its checkpoint files.
+// Checkpoints which can't be resumed are deleted: those written by a
+// fetch with a different since time or API URL, and those with a page
+// fetched more than maxCheckpointAge before now, or before the cache was
+// last synced (lastSync). Returns the time at which the earliest page in
+// the remaining checkpoints was fetched, or now if there are none. Items
+// updated after then may be missing from the resumed pages, so this is
+// the time up to which the fetch is complete.
+func resumeCheckpoints(fileNames []string, since time.Time, apiURL string, lastSync, now time.Time) (time.Time, error) {
+	syncTime := now
+	for _, fileName := range fileNames {
+		if !fileExists(fileName) {
+			continue
+		}
+		pages := readCheckpoint(fileName, since, apiURL)
+		stale := len(pages) == 0
+		for _, page := range pages {
+			if now.Sub(page.FetchedAt) > maxCheckpointAge || page.FetchedAt.Before(lastSync) {
+				stale = true
+			}
+		}
+		if stale {
+			if !settings.Quiet {
+				fmt.Printf("Discarding checkpoint %s, which can't be resumed\n", fileName)
+			}
+			if err := removeCheckpoint(fileName); err != nil {
+				return now, cacheError(fileName, err)
+			}
+			continue
+		}
+		for _, page := range pages {
+			if page.FetchedAt.Before(syncTime) {
+				syncTime = page.FetchedAt
+			}
+		}
+	}
+	return syncTime, nil
+}
+
+// appendCheckpoint appends a page to a checkpoint file.
+func appendCheckpoint(fileName string, page checkpointPage) error {
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// The encoder terminates each page with a newline.
+	err = json.NewEncoder(f).Encode(page)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// removeCheckpoint deletes a checkpoint file, if it exists.
+func removeCheckpoint(fileName string) error {
+	err := os.Remove(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
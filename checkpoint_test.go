@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResumeFromCheckpoint(t *testing.T) {
+	var mutex sync.Mutex
+	var requested []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested = append(requested, r.URL.Query().Get("page"))
+		mutex.Unlock()
+		writeIssues(w, 1)
+	})
+
+	// Pages 1 and 2 of 3 were fetched by an earlier run which failed.
+	checkpointFile := cacheFileName("owner", "repo", issuesCheckpoint)
+	fetchedAt := time.Now().Add(-time.Hour)
+	for n, numbers := range [][]int{{5, 4}, {3, 2}} {
+		page := checkpointPage{
+			APIURL:    settings.apiURL(),
+			FetchedAt: fetchedAt,
+			Page:      n + 1,
+			NumPages:  3,
+		}
+		if n == 0 {
+			page.LastPageURL = settings.apiURL() + "/repos/owner/repo/issues?state=all&page=3"
+		}
+		for _, number := range numbers {
+			page.Issues = append(page.Issues, testIssue(number))
+		}
+		if err := appendCheckpoint(checkpointFile, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := []string{checkpointFile}
+	syncTime, err := resumeCheckpoints(files, time.Time{}, settings.apiURL(), time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !syncTime.Equal(fetchedAt) {
+		t.Errorf("got sync time %v, want the time the checkpoint was fetched (%v)", syncTime, fetchedAt)
+	}
+	issues, err := getAllIssues(client, "owner", "repo", time.Time{}, newFetchProgress(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(requested) != "[3]" {
+		t.Errorf("requested pages %v, want only [3]", requested)
+	}
+	if got := issueNumbers(issues); fmt.Sprint(got) != "[5 4 3 2 1]" {
+		t.Errorf("got issues %v, want [5 4 3 2 1]", got)
+	}
+}
+
+func TestStaleCheckpoints(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	now := time.Now()
+	lastSync := now.Add(-2 * time.Hour)
+	tests := []struct {
+		name      string
+		since     time.Time
+		fetchedAt time.Time
+	}{
+		{"older than maxCheckpointAge", time.Time{}, now.Add(-maxCheckpointAge - time.Minute)},
+		{"older than the last sync", time.Time{}, lastSync.Add(-time.Minute)},
+		{"different since time", lastSync, now.Add(-time.Minute)},
+		{"written by an older version", time.Time{}, time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName := "checkpoint"
+			page := checkpointPage{Since: test.since, APIURL: githubAPIURL, FetchedAt: test.fetchedAt, Page: 1, NumPages: 2}
+			if err := appendCheckpoint(fileName, page); err != nil {
+				t.Fatal(err)
+			}
+			syncTime, err := resumeCheckpoints([]string{fileName}, time.Time{}, githubAPIURL, lastSync, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !syncTime.Equal(now) {
+				t.Errorf("got sync time %v, want now (%v)", syncTime, now)
+			}
+			if fileExists(fileName) {
+				t.Error("the checkpoint wasn't discarded")
+				removeCheckpoint(fileName)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+const (
+	// githubAPIURL is the base URL of the github.com API. Other API URLs
+	// (e.g. for GitHub Enterprise) may be given via --api-url.
+	githubAPIURL = "https://api.github.com"
+	userAgent    = "apsimissues"
+	pageCacheDir = ".pages.cache"
+
+	// Delay before the first retry of a failed request. Subsequent
+	// retries back off exponentially.
+	minRetryDelay = 1 * time.Second
+	// Longest delay between retries, unless github tells us to wait
+	// longer via the Retry-After or X-RateLimit-Reset headers.
+	maxRetryDelay = 2 * time.Minute
+)
+
+// newClient creates a github API client. Requests which fail due to
+// rate limiting or transient errors are retried, and responses are
+// cached so that unchanged pages need not be downloaded again.
+func newClient(auth octokit.AuthMethod) *octokit.Client {
+	return newClientWith(settings.apiURL(), auth, http.DefaultTransport)
+}
+
+// newClientWith creates a github API client for a given API URL, which
+// sends requests via the given transport.
+func newClientWith(baseURL string, auth octokit.AuthMethod, transport http.RoundTripper) *octokit.Client {
+	if !settings.NoPageCache {
+		transport = &conditionalTransport{base: transport, dir: pageCacheDir}
+	}
+	httpClient := &http.Client{
+		Transport: &retryTransport{
+			base:       transport,
+			maxRetries: settings.MaxRetries,
+			sleep:      time.Sleep,
+		},
+	}
+	return octokit.NewClientWith(baseURL, userAgent, auth, httpClient)
+}
+
+// retryTransport is a http.RoundTripper which retries requests that fail
+// due to rate limiting or transient network/server errors.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	sleep      func(time.Duration)
+}
+
+// RoundTrip sends a request, retrying up to maxRetries times with
+// exponential backoff if it fails with a retryable error.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.maxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := retryDelay(resp, attempt, time.Now())
+		if !settings.Quiet {
+			fmt.Printf("\nRequest to %s failed (%s); retrying in %v...\n", req.URL, describeFailure(resp, err), delay)
+		}
+		if resp != nil {
+			// Drain the body so that the connection can be reused.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		t.sleep(delay)
+
+		// The request body (if any) has been consumed, so it must be
+		// recreated before the request can be resent.
+		if req.Body != nil && req.GetBody != nil {
+			req = req.Clone(req.Context())
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// shouldRetry checks if a request which resulted in the given response
+// or error should be retried.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		// Network error.
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		// Github uses 403 for both permission errors and rate limits.
+		return resp.Header.Get("Retry-After") != "" || resp.Header.Get("X-RateLimit-Remaining") == "0"
+	}
+	return false
+}
+
+// retryDelay calculates how long to wait before retrying a request.
+// Github's Retry-After and X-RateLimit-Reset headers are honoured if
+// present; otherwise the delay increases exponentially with each
+// attempt.
+func retryDelay(resp *http.Response, attempt int, now time.Time) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if epoch, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+				// Allow an extra second for clock skew.
+				if delay := time.Unix(epoch, 0).Sub(now) + time.Second; delay > 0 {
+					return delay
+				}
+			}
+		}
+	}
+	delay := minRetryDelay << uint(attempt)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// describeFailure returns a short description of a failed request.
+func describeFailure(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		return "rate limit exceeded"
+	}
+	return resp.Status
+}
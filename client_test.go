@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// newTestClient starts a server which handles requests with handler,
+// and returns a client for it created by newClientWith.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *octokit.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	useTestSettings(t, server.URL)
+	return newClientWith(settings.apiURL(), nil, http.DefaultTransport)
+}
+
+// writeIssues writes a page of issues with the given numbers.
+func writeIssues(w http.ResponseWriter, numbers ...int) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, "[")
+	for i, n := range numbers {
+		if i > 0 {
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprintf(w, `{"number":%d,"title":"Issue %d","state":"open"}`, n, n)
+	}
+	fmt.Fprint(w, "]")
+}
+
+func TestRetryAfter(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		writeIssues(w, 2, 1)
+	})
+	issues, err := getAllIssues(client, "owner", "repo", time.Time{}, newFetchProgress(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+	if got := issueNumbers(issues); fmt.Sprint(got) != "[2 1]" {
+		t.Errorf("got issues %v, want [2 1]", got)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	if _, err := getAllIssues(client, "owner", "repo", time.Time{}, newFetchProgress(false)); err == nil {
+		t.Error("expected an error")
+	}
+	if want := int32(settings.MaxRetries + 1); requests != want {
+		t.Errorf("got %d requests, want %d (the first and %d retries)", requests, want, settings.MaxRetries)
+	}
+}
+
+// retryTest sends a request via a retryTransport to a server which
+// responds with the given statuses in turn (and 200 after that), calling
+// setHeaders before each failed response. Returns the final status and
+// the delays between attempts.
+func retryTest(t *testing.T, maxRetries int, statuses []int, setHeaders func(http.Header)) (int, []time.Duration) {
+	t.Helper()
+	useTestSettings(t, githubAPIURL)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if n <= len(statuses) {
+			setHeaders(w.Header())
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	transport := &retryTransport{
+		base:       http.DefaultTransport,
+		maxRetries: maxRetries,
+		sleep:      func(d time.Duration) { delays = append(delays, d) },
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, delays
+}
+
+func TestRetryRateLimitReset(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second)
+	status, delays := retryTest(t, 3, []int{http.StatusForbidden}, func(h http.Header) {
+		h.Set("X-RateLimit-Remaining", "0")
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	})
+	if status != http.StatusOK {
+		t.Errorf("got status %d, want 200", status)
+	}
+	if len(delays) != 1 || delays[0] < 29*time.Second || delays[0] > 32*time.Second {
+		t.Errorf("got delays %v, want one of about 31s", delays)
+	}
+}
+
+func TestRetryForbidden(t *testing.T) {
+	// A 403 which isn't due to a rate limit is a permission error, which
+	// isn't retried.
+	status, delays := retryTest(t, 3, []int{http.StatusForbidden}, func(h http.Header) {
+		h.Set("X-RateLimit-Remaining", "4000")
+	})
+	if status != http.StatusForbidden || len(delays) != 0 {
+		t.Errorf("got status %d after %d retries, want 403 without retrying", status, len(delays))
+	}
+}
+
+func TestRetryServerError(t *testing.T) {
+	status, delays := retryTest(t, 3, []int{http.StatusBadGateway, http.StatusInternalServerError}, func(http.Header) {})
+	if status != http.StatusOK {
+		t.Errorf("got status %d, want 200", status)
+	}
+	if fmt.Sprint(delays) != fmt.Sprint([]time.Duration{minRetryDelay, 2 * minRetryDelay}) {
+		t.Errorf("got delays %v, want exponential backoff from %v", delays, minRetryDelay)
+	}
+}
+
+func TestRetryMaxRetries(t *testing.T) {
+	statuses := []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+	status, delays := retryTest(t, 2, statuses, func(http.Header) {})
+	if status != http.StatusBadGateway || len(delays) != 2 {
+		t.Errorf("got status %d after %d retries, want 502 after 2", status, len(delays))
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// fetchCommand fetches data from github and updates the cache.
+type fetchCommand struct{}
+
+// Execute fetches all data, ignoring any cached data unless running in
+// incremental mode.
+func (c *fetchCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	if settings.AsOf != "" {
+		return withExitCode(exitBadArguments, fmt.Errorf("--as-of can't be used with the fetch command"))
+	}
+	settings.UseCache = false
+	issues, pulls, err := getAllData(parsed)
+	if err != nil {
+		return err
+	}
+	if !settings.Quiet {
+		fmt.Printf("Fetched %d issues and %d pull requests from %s.\n", len(issues), len(pulls), parsed.repositoryNames())
+	}
+	return nil
+}
+
+// reportCommand prints statistics about issues and pull requests.
+type reportCommand struct{}
+
+// Execute prints the report. Data is read from the cache, and is only
+// fetched from github if there is no cached data.
+func (c *reportCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	settings.UseCache = true
+	issues, pulls, err := loadData(parsed)
+	if err != nil {
+		return err
+	}
+	printReport(issues, pulls, parsed)
+	return nil
+}
+
+// graphCommand generates graphs.
+type graphCommand struct {
+	Args struct {
+		Names []string `positional-arg-name:"name" description:"Names of the graphs to generate (default: the graphs given by --graphs, or all graphs)"`
+	} `positional-args:"yes"`
+}
+
+// Execute generates the graphs selected by the user. Data is read from
+// the cache, and is only fetched from github if there is no cached data.
+func (c *graphCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	graphs, err := selectedGraphs(c.Args.Names)
+	if err != nil {
+		return withExitCode(exitBadArguments, err)
+	}
+	settings.UseCache = true
+	issues, pulls, err := loadData(parsed)
+	if err != nil {
+		return err
+	}
+	return drawGraphs(issues, pulls, graphs, parsed)
+}
+
+// cacheCommand inspects or manages the cache.
+type cacheCommand struct {
+	Info   cacheInfoCommand   `command:"info" description:"Show what is in the cache"`
+	Clear  cacheClearCommand  `command:"clear" description:"Delete the cache"`
+	Export cacheExportCommand `command:"export" description:"Export cached data as json"`
+}
+
+// cacheFiles returns the names of all cache and checkpoint files for a
+// repository, including backups and temporary files.
+func cacheFiles(repo repository) []string {
+	var files []string
+	for _, kind := range []string{issuesCache, pullsCache, linksCache, metadataCache} {
+		fileName := cacheFileName(repo.Owner, repo.Name, kind)
+		files = append(files, fileName, backupFileName(fileName), tempFileName(fileName))
+	}
+	for _, kind := range []string{issuesCheckpoint, pullsCheckpoint} {
+		files = append(files, cacheFileName(repo.Owner, repo.Name, kind))
+	}
+	return files
+}
+
+// cacheInfoCommand shows what is in the cache.
+type cacheInfoCommand struct{}
+
+// Execute prints a summary of the cached data for each repository.
+func (c *cacheInfoCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	for _, repo := range parsed.repositories {
+		fmt.Printf("%s:\n", repo)
+		if !hasCacheFiles(repo.Owner, repo.Name) {
+			fmt.Printf("    No cached data\n")
+			continue
+		}
+		data, err := readCachedRepository(repo)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("    Issues:                                 %d\n", len(data.Issues))
+		fmt.Printf("    Pull requests:                          %d\n", len(data.Pulls))
+		fmt.Printf("    Issue links:                            %d\n", len(data.Links))
+		if data.LastSync.IsZero() {
+			fmt.Printf("    Last synced:                            unknown\n")
+		} else {
+			fmt.Printf("    Last synced:                            %s\n", data.LastSync.Local().Format(time.RFC1123))
+		}
+		fmt.Printf("    API URL:                                %s\n", data.APIURL)
+
+		header, err := readCacheHeader(cacheFileName(repo.Owner, repo.Name, issuesCache), issuesCache, repo)
+		if err != nil {
+			return err
+		}
+		if header.SchemaVersion < cacheSchemaVersion {
+			fmt.Printf("    Schema version:                         %d (updated by the next fetch)\n", header.SchemaVersion)
+		} else {
+			fmt.Printf("    Schema version:                         %d\n", header.SchemaVersion)
+		}
+		if !header.LastUpdated.IsZero() {
+			fmt.Printf("    Last updated issue:                     %s\n", header.LastUpdated.Local().Format(time.RFC1123))
+		}
+
+		var checkpoints []string
+		if fileExists(cacheFileName(repo.Owner, repo.Name, issuesCheckpoint)) {
+			checkpoints = append(checkpoints, "issues")
+		}
+		if fileExists(cacheFileName(repo.Owner, repo.Name, pullsCheckpoint)) {
+			checkpoints = append(checkpoints, "pull requests")
+		}
+		if len(checkpoints) > 0 {
+			fmt.Printf("    Interrupted fetch of:                   %s\n", strings.Join(checkpoints, ", "))
+		}
+	}
+
+	entries, err := ioutil.ReadDir(pageCacheDir)
+	if err != nil && !os.IsNotExist(err) {
+		return cacheError(pageCacheDir, err)
+	}
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size()
+	}
+	fmt.Printf("Page cache (%s):                     %d pages, %d KiB\n", pageCacheDir, len(entries), size/1024)
+	return nil
+}
+
+// cacheClearCommand deletes the cache.
+type cacheClearCommand struct {
+	Pages     bool `long:"pages" description:"Also delete the page cache, which is shared by all repositories"`
+	Snapshots bool `long:"snapshots" description:"Also delete all snapshots of the repositories"`
+}
+
+// Execute deletes the cache and checkpoint files for each repository.
+func (c *cacheClearCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	for _, repo := range parsed.repositories {
+		for _, file := range cacheFiles(repo) {
+			err := os.Remove(file)
+			if err != nil && !os.IsNotExist(err) {
+				return cacheError(file, err)
+			}
+			if err == nil && !settings.Quiet {
+				fmt.Printf("Deleted %s\n", file)
+			}
+		}
+		if c.Snapshots {
+			dir := repositorySnapshotDir(repo)
+			if err := os.RemoveAll(dir); err != nil {
+				return cacheError(dir, err)
+			}
+			if !settings.Quiet {
+				fmt.Printf("Deleted %s\n", dir)
+			}
+		}
+	}
+	if c.Pages {
+		if err := os.RemoveAll(pageCacheDir); err != nil {
+			return cacheError(pageCacheDir, err)
+		}
+		if !settings.Quiet {
+			fmt.Printf("Deleted %s\n", pageCacheDir)
+		}
+	}
+	return nil
+}
+
+// cacheExportCommand exports cached data as json.
+type cacheExportCommand struct {
+	Output string `short:"o" long:"output" description:"File to write to (default: standard output)"`
+}
+
+// cachedRepository is the cached data for a repository, as exported by
+// the cache export command.
+type cachedRepository struct {
+	Repository string                `json:"repository"`
+	APIURL     string                `json:"api_url"`
+	LastSync   time.Time             `json:"last_sync"`
+	Issues     []octokit.Issue       `json:"issues"`
+	Pulls      []octokit.PullRequest `json:"pulls"`
+	Links      []issueLink           `json:"links"`
+}
+
+// readCachedRepository reads all cached data for a repository.
+func readCachedRepository(repo repository) (cachedRepository, error) {
+	data := cachedRepository{Repository: repo.String(), APIURL: githubAPIURL}
+	metadataFile := cacheFileName(repo.Owner, repo.Name, metadataCache)
+	if fileExists(metadataFile) {
+		metadata, err := metadataFromCache(metadataFile)
+		if err != nil {
+			return data, err
+		}
+		data.LastSync = metadata.LastSync
+		data.APIURL = defaultAPIURL(metadata.APIURL)
+	}
+	var err error
+	data.Issues, data.Pulls, err = getDataFromCache(
+		cacheFileName(repo.Owner, repo.Name, issuesCache),
+		cacheFileName(repo.Owner, repo.Name, pullsCache), repo, data.LastSync)
+	if err != nil {
+		return data, err
+	}
+	linksFile := cacheFileName(repo.Owner, repo.Name, linksCache)
+	if fileExists(linksFile) {
+		data.Links, err = linksFromCache(linksFile, repo, data.LastSync)
+		if err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+// Execute writes the cached data for all repositories as a json array.
+// Fails if any repository has no cached data.
+func (c *cacheExportCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	var data []cachedRepository
+	for _, repo := range parsed.repositories {
+		if !hasCacheFiles(repo.Owner, repo.Name) {
+			return withExitCode(exitCacheFailure, fmt.Errorf("no cached data for %s", repo))
+		}
+		repoData, err := readCachedRepository(repo)
+		if err != nil {
+			return err
+		}
+		data = append(data, repoData)
+	}
+
+	if c.Output == "" {
+		return writeExport(os.Stdout, data)
+	}
+	f, err := os.Create(c.Output)
+	if err != nil {
+		return err
+	}
+	if err := writeExport(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeExport writes exported data as indented json.
+func writeExport(w io.Writer, data []cachedRepository) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// snapshotCommand lists or compares snapshots.
+type snapshotCommand struct {
+	List snapshotListCommand `command:"list" description:"List the snapshots of each repository"`
+	Diff snapshotDiffCommand `command:"diff" description:"Show the changes to the state, labels and assignees of issues and pull requests between two snapshots"`
+}
+
+// snapshotListCommand lists snapshots.
+type snapshotListCommand struct{}
+
+// Execute prints the times at which the snapshots of each repository
+// were taken.
+func (c *snapshotListCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	for _, repo := range parsed.repositories {
+		fmt.Printf("%s:\n", repo)
+		times, err := listSnapshots(repo)
+		if err != nil {
+			return err
+		}
+		if len(times) == 0 {
+			fmt.Printf("    No snapshots\n")
+		}
+		for _, taken := range times {
+			fmt.Printf("    %s\n", taken.Local().Format(time.RFC1123))
+		}
+	}
+	return nil
+}
+
+// snapshotDiffCommand compares two snapshots.
+type snapshotDiffCommand struct {
+	Args struct {
+		From string `positional-arg-name:"from" required:"yes" description:"Date of the earlier snapshot, in the same forms as --since"`
+		To   string `positional-arg-name:"to" description:"Date of the later snapshot (default: the latest snapshot)"`
+	} `positional-args:"yes"`
+}
+
+// Execute prints the changes between the latest snapshots of each
+// repository taken on or before the two dates given by the user.
+func (c *snapshotDiffCommand) Execute(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	now := time.Now()
+	fromDeadline, err := snapshotDeadline(c.Args.From, now)
+	if err != nil {
+		return withExitCode(exitBadArguments, err)
+	}
+	var toDeadline time.Time
+	if c.Args.To != "" {
+		if toDeadline, err = snapshotDeadline(c.Args.To, now); err != nil {
+			return withExitCode(exitBadArguments, err)
+		}
+	}
+	for _, repo := range parsed.repositories {
+		from, err := findSnapshot(repo, c.Args.From, fromDeadline)
+		if err != nil {
+			return err
+		}
+		var to time.Time
+		if c.Args.To == "" {
+			times, err := listSnapshots(repo)
+			if err != nil {
+				return err
+			}
+			to = times[len(times)-1]
+		} else if to, err = findSnapshot(repo, c.Args.To, toDeadline); err != nil {
+			return err
+		}
+
+		fromIssues, fromPulls, _, err := readSnapshot(repo, from)
+		if err != nil {
+			return err
+		}
+		toIssues, toPulls, _, err := readSnapshot(repo, to)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s -> %s\n", repo, from.Local().Format(time.RFC1123), to.Local().Format(time.RFC1123))
+		changes := diffIssues(fromIssues, toIssues)
+		for _, change := range diffPulls(fromPulls, toPulls) {
+			changes = append(changes, "Pull request "+change)
+		}
+		if len(changes) == 0 {
+			fmt.Printf("    No changes\n")
+		}
+		for _, change := range changes {
+			fmt.Printf("    %s\n", change)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// gzipMagic is the start of every gzip-compressed file.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// readCacheFile reads the contents of a cache file, decompressing them
+// if the file is gzip-compressed (see --compress).
+func readCacheFile(fileName string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil || !bytes.HasPrefix(contents, gzipMagic) {
+		return contents, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// nopWriteCloser is a writer which does nothing when closed.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// cacheWriter returns a writer which writes to a cache file, compressing
+// the data if the user has asked for compressed caches. The writer must
+// be closed before the file is closed.
+func cacheWriter(w io.Writer) io.WriteCloser {
+	if settings.Compress {
+		return gzip.NewWriter(w)
+	}
+	return nopWriteCloser{w}
+}
+
+// stripIssue returns a copy of an issue which only holds the fields used
+// by this program (see --strip-fields).
+func stripIssue(issue octokit.Issue) octokit.Issue {
+	stripped := octokit.Issue{
+		URL:       issue.URL,
+		Number:    issue.Number,
+		State:     issue.State,
+		Title:     issue.Title,
+		Body:      issue.Body,
+		Comments:  issue.Comments,
+		CreatedAt: issue.CreatedAt,
+		ClosedAt:  issue.ClosedAt,
+		UpdatedAt: issue.UpdatedAt,
+	}
+	stripped.User.Login = issue.User.Login
+	stripped.Assignee.Login = issue.Assignee.Login
+	stripped.Milestone.Number = issue.Milestone.Number
+	stripped.Milestone.State = issue.Milestone.State
+	stripped.Milestone.Title = issue.Milestone.Title
+	stripped.PullRequest.HTMLURL = issue.PullRequest.HTMLURL
+	stripped.Labels = append(stripped.Labels, issue.Labels...)
+	for i := range stripped.Labels {
+		stripped.Labels[i].URL = ""
+		stripped.Labels[i].Color = ""
+	}
+	return stripped
+}
+
+// stripPull returns a copy of a pull request which only holds the fields
+// used by this program (see --strip-fields).
+func stripPull(pull octokit.PullRequest) octokit.PullRequest {
+	stripped := octokit.PullRequest{
+		URL:       pull.URL,
+		Number:    pull.Number,
+		State:     pull.State,
+		Title:     pull.Title,
+		Body:      pull.Body,
+		Comments:  pull.Comments,
+		CreatedAt: pull.CreatedAt,
+		UpdatedAt: pull.UpdatedAt,
+		ClosedAt:  pull.ClosedAt,
+		MergedAt:  pull.MergedAt,
+	}
+	stripped.User.Login = pull.User.Login
+	if pull.Assignee != nil {
+		stripped.Assignee = &octokit.User{Login: pull.Assignee.Login}
+	}
+	return stripped
+}
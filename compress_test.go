@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+func TestCompressedCache(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	repo := repository{Owner: "owner", Name: "repo"}
+	fileName := filepath.Join(t.TempDir(), "issues.cache")
+	fetchedAt := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
+
+	// Compression can be switched on and off for an existing cache file,
+	// which is read either way.
+	for i, compress := range []bool{false, true, true, false} {
+		settings.Compress = compress
+		issues := []octokit.Issue{testIssue(i + 1), testIssue(0)}
+		if err := writeIssuesToCache(fileName, newCacheHeader(repo, fetchedAt), issues); err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.HasPrefix(contents, gzipMagic); got != compress {
+			t.Errorf("write %d: file compressed = %v, want %v", i+1, got, compress)
+		}
+		// The setting doesn't affect reading.
+		settings.Compress = !compress
+		got, err := issuesFromCache(fileName, repo, fetchedAt)
+		if err != nil {
+			t.Fatalf("write %d: %v", i+1, err)
+		}
+		if fmt.Sprint(issueNumbers(got)) != fmt.Sprint(issueNumbers(issues)) {
+			t.Errorf("write %d: got issues %v, want %v", i+1, issueNumbers(got), issueNumbers(issues))
+		}
+	}
+
+	// The backup of a compressed file is compressed too.
+	backup, err := ioutil.ReadFile(backupFileName(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(backup, gzipMagic) {
+		t.Error("the backup of a compressed file isn't compressed")
+	}
+}
+
+func TestReadCacheFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		contents []byte
+		want     string
+		wantErr  bool
+	}{
+		{"plain", []byte(`[{"number": 1}]`), `[{"number": 1}]`, false},
+		{"empty", nil, "", false},
+		{"truncated gzip", gzipMagic, "", true},
+	}
+	for _, test := range tests {
+		fileName := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(fileName, test.contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readCacheFile(fileName)
+		if (err != nil) != test.wantErr || string(got) != test.want {
+			t.Errorf("%s: got %q (%v), want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestStripFields(t *testing.T) {
+	closed := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	issue := labeledIssue("bug")
+	issue.Number, issue.Title, issue.Body, issue.ClosedAt = 1, "Title", "Body", &closed
+	issue.Labels[0].Color = "ff0000"
+	issue.User.Login, issue.User.AvatarURL = "alice", "https://avatars.example.com/alice"
+	issue.Milestone.Title, issue.Milestone.Description = "v1.0", "The first release"
+	stripped := stripIssue(issue)
+	if stripped.Number != 1 || stripped.Title != "Title" || stripped.Body != "Body" || stripped.ClosedAt != issue.ClosedAt ||
+		stripped.User.Login != "alice" || stripped.Milestone.Title != "v1.0" || stripped.Labels[0].Name != "bug" {
+		t.Errorf("stripping an issue removed a field which is used: %+v", stripped)
+	}
+	if stripped.User.AvatarURL != "" || stripped.Milestone.Description != "" || stripped.Labels[0].Color != "" {
+		t.Error("stripping an issue kept a field which isn't used")
+	}
+	if issue.Labels[0].Color != "ff0000" {
+		t.Error("stripping an issue changed the original")
+	}
+
+	pull := octokit.PullRequest{Number: 2, Title: "Fix", MergedAt: &closed, Assignee: &octokit.User{Login: "bob", Name: "Bob"}}
+	strippedPull := stripPull(pull)
+	if strippedPull.Number != 2 || strippedPull.MergedAt != pull.MergedAt || strippedPull.Assignee.Login != "bob" {
+		t.Errorf("stripping a pull request removed a field which is used: %+v", strippedPull)
+	}
+	if strippedPull.Assignee.Name != "" {
+		t.Error("stripping a pull request kept a field which isn't used")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the config file which is used if it exists and
+// no other config file is given.
+const defaultConfigFile = "apsimissues.yaml"
+
+// labelAliasesKey is the config file setting which holds the label
+// aliases. This setting has no corresponding command line option.
+const labelAliasesKey = "label-aliases"
+
+// configFileOption holds the --config option. It is parsed before the
+// other options, so that the config file can be loaded first.
+type configFileOption struct {
+	Config string `long:"config"`
+}
+
+// configFileName returns the name of the config file given by the
+// --config option, and whether it was given explicitly.
+func configFileName(args []string) (string, bool) {
+	var opt configFileOption
+	parser := flags.NewParser(&opt, flags.IgnoreUnknown)
+	parser.ParseArgs(args)
+	if opt.Config == "" {
+		return defaultConfigFile, false
+	}
+	return opt.Config, true
+}
+
+// loadConfig reads a yaml config file, and uses its settings as the
+// default values of the command line options. Each setting is named
+// after the long name of an option (e.g. since, repository, graphs), so
+// options given on the command line override the config file. Settings
+// for options which may be given several times are lists; a list given
+// for any other option is joined with commas. A missing config file is
+// only an error if required is set.
+func loadConfig(parser *flags.Parser, fileName string, required bool) error {
+	contents, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	var config map[string]yaml.Node
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("invalid config file '%s': %w", fileName, err)
+	}
+	for key, node := range config {
+		if key == labelAliasesKey {
+			if err := node.Decode(&settings.labelAliases); err != nil {
+				return fmt.Errorf("invalid %s in config file '%s': %w", key, fileName, err)
+			}
+			continue
+		}
+
+		option := parser.FindOptionByLongName(key)
+		if option == nil {
+			return fmt.Errorf("unknown setting '%s' in config file '%s'", key, fileName)
+		}
+		var values []string
+		if node.Kind == yaml.SequenceNode {
+			err = node.Decode(&values)
+		} else {
+			values = []string{""}
+			err = node.Decode(&values[0])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s in config file '%s': %w", key, fileName, err)
+		}
+		if option.Field().Type.Kind() != reflect.Slice && len(values) > 1 {
+			values = []string{strings.Join(values, ",")}
+		}
+		option.Default = values
+	}
+	return nil
+}
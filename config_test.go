@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// parseWithConfig parses command line arguments, using the settings in
+// a config file as defaults.
+func parseWithConfig(t *testing.T, config string, args ...string) error {
+	t.Helper()
+	if err := ioutil.WriteFile("test.yaml", []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings = options{}
+	parser := flags.NewParser(&settings, flags.HelpFlag|flags.PassDoubleDash)
+	parser.SubcommandsOptional = true
+	if err := loadConfig(parser, "test.yaml", true); err != nil {
+		return err
+	}
+	_, err := parser.ParseArgs(args)
+	return err
+}
+
+func TestLoadConfig(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	config := `
+since: 1/7/2025
+repository: [APSIMInitiative/ApsimX, APSIMInitiative/APSIM.Shared]
+graphs: [openIssues, bugs]
+workers: 8
+quiet: true
+bot: [apsimbot]
+label-aliases:
+  bug: [defect, "type: bug"]
+`
+	if err := parseWithConfig(t, config); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		setting   string
+		got, want interface{}
+	}{
+		{"since", settings.Date, "1/7/2025"},
+		{"repository", settings.RepoList, []string{"APSIMInitiative/ApsimX", "APSIMInitiative/APSIM.Shared"}},
+		{"graphs", settings.GraphOptions.Graphs, "openIssues,bugs"},
+		{"workers", settings.Workers, 8},
+		{"quiet", settings.Quiet, true},
+		{"bot", settings.Bots, []string{"apsimbot"}},
+		{"label-aliases", settings.labelAliases, map[string][]string{"bug": {"defect", "type: bug"}}},
+		// Options which aren't in the config file keep their defaults.
+		{"owner", settings.Owner, "APSIMInitiative"},
+		{"max-retries", settings.MaxRetries, 5},
+	}
+	for _, test := range tests {
+		if fmt.Sprint(test.got) != fmt.Sprint(test.want) {
+			t.Errorf("%s = %v, want %v", test.setting, test.got, test.want)
+		}
+	}
+
+	// Options given on the command line override the config file.
+	if err := parseWithConfig(t, config, "--since", "1/1/2020", "--repository", "owner/repo", "--workers", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Date != "1/1/2020" || fmt.Sprint(settings.RepoList) != "[owner/repo]" || settings.Workers != 2 {
+		t.Errorf("command line options didn't override the config file: since %s, repository %v, workers %d",
+			settings.Date, settings.RepoList, settings.Workers)
+	}
+}
+
+func TestLabelAliases(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	if err := parseWithConfig(t, "label-aliases:\n  bug: [defect, \"type: bug\"]\n"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		labels string
+		label  string
+		want   bool
+	}{
+		{`[{"name": "bug"}]`, "bug", true},
+		{`[{"name": "defect"}]`, "bug", true},
+		{`[{"name": "type: bug"}]`, "bug", true},
+		{`[{"name": "Defect"}]`, "bug", false},
+		{`[]`, "bug", false},
+		// Aliases only apply one way.
+		{`[{"name": "bug"}]`, "defect", false},
+		{`[{"name": "defect"}]`, "defect", true},
+	}
+	for _, test := range tests {
+		var issue octokit.Issue
+		if err := json.Unmarshal([]byte(`{"labels": `+test.labels+`}`), &issue); err != nil {
+			t.Fatal(err)
+		}
+		if got := hasLabel(issue, test.label); got != test.want {
+			t.Errorf("an issue labelled %s has label %s = %v, want %v", test.labels, test.label, got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	tests := []struct {
+		config string
+		// want is a part of the expected error message.
+		want string
+	}{
+		{"colour: red\n", "unknown setting 'colour'"},
+		{"since: [1/1/2020\n", "invalid config file"},
+		{"- since\n", "invalid config file"},
+		{"workers: {count: 4}\n", "invalid workers"},
+		{"label-aliases: [bug, defect]\n", "invalid label-aliases"},
+	}
+	for _, test := range tests {
+		err := parseWithConfig(t, test.config)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.config)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %q, want %q", test.config, err, test.want)
+		}
+	}
+
+	// A missing config file is only an error if it was given explicitly.
+	parser := flags.NewParser(&settings, flags.HelpFlag)
+	if err := loadConfig(parser, "missing.yaml", false); err != nil {
+		t.Errorf("missing default config file: %v", err)
+	}
+	if err := loadConfig(parser, "missing.yaml", true); err == nil {
+		t.Error("missing config file given by --config: expected an error")
+	}
+}
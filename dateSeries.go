@@ -27,16 +27,17 @@ func seriesFromMap(title string, data map[time.Time]int) dateSeries {
 }
 
 // getXYPairs returns the graph's XY data as a plotter.XYs object.
-func (S dateSeries) getXYPairs() plotter.XYs {
+// Returns an error if the x and y data have different lengths.
+func (S dateSeries) getXYPairs() (plotter.XYs, error) {
 	if len(S.X) != len(S.Y) {
-		panic(fmt.Sprintf("Error in series '%s': x/y data length mismatch", S.Name))
+		return nil, fmt.Errorf("error in series '%s': x/y data length mismatch", S.Name)
 	}
 	points := make(plotter.XYs, len(S.X))
 	for i, date := range S.X {
 		points[i].X = float64(date.Unix())
 		points[i].Y = float64(S.Y[i])
 	}
-	return points
+	return points, nil
 }
 
 // getName returns the series' name to be used in the legend.
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// Exit codes. These are documented in the readme, as scripts which run
+// this program may rely on them.
+const (
+	exitSuccess = 0
+	// exitFailure is used for errors which don't fit any other category.
+	exitFailure = 1
+	// exitBadArguments is used when the command line arguments are
+	// invalid.
+	exitBadArguments = 2
+	// exitAuthFailure is used when the credentials can't be read, or are
+	// rejected by github.
+	exitAuthFailure = 3
+	// exitNetworkFailure is used when data can't be fetched from github.
+	exitNetworkFailure = 4
+	// exitCacheFailure is used when the cache is corrupt, or can't be
+	// read or written.
+	exitCacheFailure = 5
+	// exitRenderFailure is used when a graph can't be generated.
+	exitRenderFailure = 6
+)
+
+// exitError is an error which causes the program to exit with a given
+// exit code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode attaches an exit code to an error. If the error already
+// has an exit code, it is returned unchanged, so the most specific
+// cause of an error determines the exit code. Returns nil if err is nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for an error: exitSuccess if the error
+// is nil, or exitFailure if no exit code has been attached to it.
+func exitCode(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
+
+// fetchError attaches an exit code to an error which occurred while
+// fetching data from github. Requests rejected because of bad
+// credentials are authentication failures; anything else is a network
+// failure.
+func fetchError(err error) error {
+	var responseErr *octokit.ResponseError
+	if errors.As(err, &responseErr) && responseErr.Response != nil &&
+		responseErr.Response.StatusCode == http.StatusUnauthorized {
+		return withExitCode(exitAuthFailure, err)
+	}
+	return withExitCode(exitNetworkFailure, err)
+}
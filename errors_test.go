@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+func TestExitCode(t *testing.T) {
+	responseError := func(status int) error {
+		return fmt.Errorf("unable to fetch issues: %w", &octokit.ResponseError{Response: &http.Response{StatusCode: status}})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no error", nil, exitSuccess},
+		{"no exit code", errors.New("failed"), exitFailure},
+		{"exit code", withExitCode(exitCacheFailure, errors.New("failed")), exitCacheFailure},
+		{"wrapped exit code", fmt.Errorf("context: %w", withExitCode(exitRenderFailure, errors.New("failed"))), exitRenderFailure},
+		{"innermost exit code", withExitCode(exitBadArguments, withExitCode(exitCacheFailure, errors.New("failed"))), exitCacheFailure},
+		{"unauthorised", fetchError(responseError(http.StatusUnauthorized)), exitAuthFailure},
+		{"forbidden", fetchError(responseError(http.StatusForbidden)), exitNetworkFailure},
+		{"server error", fetchError(responseError(http.StatusInternalServerError)), exitNetworkFailure},
+		{"network error", fetchError(errors.New("connection refused")), exitNetworkFailure},
+		{"cache error while fetching", fetchError(withExitCode(exitCacheFailure, errors.New("failed"))), exitCacheFailure},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.err); got != test.want {
+			t.Errorf("%s: got exit code %d, want %d", test.name, got, test.want)
+		}
+	}
+	if withExitCode(exitFailure, nil) != nil {
+		t.Error("withExitCode attached an exit code to a nil error")
+	}
+}
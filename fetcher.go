@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// Fetch backends.
+const (
+	restBackend    = "rest"
+	graphqlBackend = "graphql"
+)
+
+// fetcher fetches issues and pull requests from github.
+type fetcher interface {
+	// fetch gets all issues and pull requests on a github repository,
+	// and any links between them reported by github. If since is not
+	// the zero time, only issues and pull requests updated since then
+	// are fetched.
+	fetch(owner, repo string, since time.Time, showProgress bool) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error)
+}
+
+// newFetcher creates a fetcher which uses the backend selected by the
+// user.
+func newFetcher(auth octokit.AuthMethod) fetcher {
+	if settings.Backend == graphqlBackend {
+		return graphqlFetcher{client: newGraphQLClient(auth)}
+	}
+	return restFetcher{client: newClient(auth), links: newGraphQLClient(auth)}
+}
+
+// restFetcher fetches data via the github REST API. The links between
+// issues and pull requests aren't available from the REST API (other
+// than by fetching the timeline of every issue), so these are fetched
+// via the GraphQL API (see getLinksGraphQL) if possible. Otherwise, the
+// closing keywords in the bodies of pull requests are used instead (see
+// parseClosingReferences).
+type restFetcher struct {
+	client *octokit.Client
+	links  *graphqlClient
+}
+
+// fetch gets all issues and pull requests on a github repository, and
+// the links between them. Failing to fetch the links (e.g. because the
+// host or the credentials don't support the GraphQL API) isn't an error.
+func (f restFetcher) fetch(owner, repo string, since time.Time, showProgress bool) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error) {
+	issues, pulls, err := getDataFromGithub(f.client, owner, repo, since, showProgress)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	progress := newFetchProgress(showProgress)
+	links, err := getLinksGraphQL(f.links, owner, repo, since, progress)
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using closing keywords in pull request bodies instead\n", err)
+		return issues, pulls, nil, nil
+	}
+	return issues, pulls, links, nil
+}
+
+// graphqlFetcher fetches data via the github GraphQL API.
+type graphqlFetcher struct {
+	client *graphqlClient
+}
+
+// fetch gets all issues and pull requests on a github repository, and
+// the links between them.
+func (f graphqlFetcher) fetch(owner, repo string, since time.Time, showProgress bool) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error) {
+	return getDataFromGraphQL(f.client, owner, repo, since, showProgress)
+}
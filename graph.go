@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,9 +12,9 @@ import (
 )
 
 // Creates a scatter plot with the given parameters
-func createLinePlot(title, xlabel, ylabel, fileName string, data ...series) {
+func createLinePlot(title, xlabel, ylabel, fileName string, data ...series) error {
 	if data == nil || len(data) < 1 {
-		panic("Graph error: No series provided")
+		return renderError(fileName, errors.New("no series provided"))
 	}
 	p := plot.New()
 
@@ -48,29 +49,37 @@ func createLinePlot(title, xlabel, ylabel, fileName string, data ...series) {
 	colours := palette.Rainbow(len(data)+1, 0, 1, 1, 1, 1).Colors()
 
 	for i := 0; i < len(data); i++ {
-		line, err := plotter.NewLine(data[i].getXYPairs())
+		points, err := data[i].getXYPairs()
+		if err != nil {
+			return renderError(fileName, err)
+		}
+		line, err := plotter.NewLine(points)
+		if err != nil {
+			return renderError(fileName, err)
+		}
 		line.LineStyle.Width = 2
 		if len(data) > 1 {
 			line.LineStyle.Color = colours[i]
 			p.Legend.Add(data[i].getName(), line)
 		}
-		if err != nil {
-			panic(err)
-		}
 		p.Add(line)
 	}
 
 	// Write to disk
 	var err = p.Save(1920, 1080, fileName)
 	if err != nil {
-		panic(err)
+		return renderError(fileName, err)
 	}
 	if !settings.Quiet {
 		fmt.Printf("Generated graph '%s'\n", fileName)
 	}
+	return nil
 }
 
-func createBarChart(title string, xAxisLabel string, yAxisLabel string, fileName string, data ...barSeries) {
+func createBarChart(title string, xAxisLabel string, yAxisLabel string, fileName string, data ...barSeries) error {
+	if len(data) < 1 {
+		return renderError(fileName, errors.New("no series provided"))
+	}
 	p := plot.New()
 	var baseFontSize vg.Length = 36
 	var barLength vg.Length = 18
@@ -101,7 +110,7 @@ func createBarChart(title string, xAxisLabel string, yAxisLabel string, fileName
 	for i, series := range data {
 		chart, err := plotter.NewBarChart(series, barLength)
 		if err != nil {
-			panic(err)
+			return renderError(fileName, err)
 		}
 		p.Add(chart)
 		chart.Color = colours[i]
@@ -130,11 +139,18 @@ func createBarChart(title string, xAxisLabel string, yAxisLabel string, fileName
 	// Write to disk
 	var err = p.Save(2560, 1440, fileName)
 	if err != nil {
-		panic(err)
+		return renderError(fileName, err)
 	}
 	if !settings.Quiet {
 		fmt.Printf("Generated graph '%s'\n", fileName)
 	}
+	return nil
+}
+
+// renderError attaches the rendering failure exit code to an error which
+// occurred while generating a graph.
+func renderError(fileName string, err error) error {
+	return withExitCode(exitRenderFailure, fmt.Errorf("unable to generate graph '%s': %w", fileName, err))
 }
 
 // Ticks generates ticks for the time axis
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// graphqlClient sends queries to the github GraphQL API.
+type graphqlClient struct {
+	// url is the GraphQL endpoint.
+	url string
+	// apiURL is the base URL of the REST API. It is used to fill in the
+	// API URLs of issues and pull requests, which are not available via
+	// GraphQL.
+	apiURL     string
+	auth       octokit.AuthMethod
+	httpClient *http.Client
+}
+
+// newGraphQLClient creates a github GraphQL API client. Requests are
+// retried in the same way as for the REST client.
+func newGraphQLClient(auth octokit.AuthMethod) *graphqlClient {
+	apiURL := settings.apiURL()
+	return newGraphQLClientWith(graphqlURL(apiURL), apiURL, auth, http.DefaultTransport)
+}
+
+// graphqlURL returns the GraphQL endpoint for a REST API URL. On
+// github.com this is https://api.github.com/graphql. On GitHub
+// Enterprise, the REST API is at /api/v3 and GraphQL at /api/graphql.
+func graphqlURL(apiURL string) string {
+	apiURL = strings.TrimSuffix(apiURL, "/")
+	if strings.HasSuffix(apiURL, "/api/v3") {
+		return strings.TrimSuffix(apiURL, "/v3") + "/graphql"
+	}
+	return apiURL + "/graphql"
+}
+
+// newGraphQLClientWith creates a github GraphQL API client for a given
+// GraphQL endpoint and REST API URL, which sends requests via the given
+// transport.
+func newGraphQLClientWith(url, apiURL string, auth octokit.AuthMethod, transport http.RoundTripper) *graphqlClient {
+	return &graphqlClient{
+		url:    url,
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		auth:   auth,
+		httpClient: &http.Client{
+			Transport: &retryTransport{
+				base:       transport,
+				maxRetries: settings.MaxRetries,
+				sleep:      time.Sleep,
+			},
+		},
+	}
+}
+
+// graphqlResponse is the body of a response from the GraphQL API.
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// query sends a GraphQL query and decodes the data in the response into
+// result.
+func (c *graphqlClient) query(query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if c.auth != nil {
+		req.Header.Set("Authorization", c.auth.String())
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return withExitCode(exitAuthFailure, fmt.Errorf("graphql query failed: %s", resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("graphql query failed: %s", resp.Status)
+	}
+
+	var response graphqlResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		var messages []string
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("graphql query failed: %s", strings.Join(messages, "; "))
+	}
+	return json.Unmarshal(response.Data, result)
+}
+
+// graphqlPageInfo holds the pagination information of a connection.
+type graphqlPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// graphqlUser is a user (or bot) as returned by the GraphQL API. It is
+// null for deleted users.
+type graphqlUser struct {
+	Login string `json:"login"`
+}
+
+// graphqlLabels is a connection of labels.
+type graphqlLabels struct {
+	Nodes []struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	} `json:"nodes"`
+}
+
+// graphqlIssueRef is a reference to an issue or pull request, possibly
+// in another repository.
+type graphqlIssueRef struct {
+	Typename   string `json:"__typename"`
+	Number     int    `json:"number"`
+	Repository struct {
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"repository"`
+}
+
+// graphqlIssue is an issue as returned by issuesQuery.
+type graphqlIssue struct {
+	Number    int          `json:"number"`
+	Title     string       `json:"title"`
+	Body      string       `json:"body"`
+	State     string       `json:"state"`
+	URL       string       `json:"url"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	ClosedAt  *time.Time   `json:"closedAt"`
+	Author    *graphqlUser `json:"author"`
+	Assignees struct {
+		Nodes []graphqlUser `json:"nodes"`
+	} `json:"assignees"`
+	Milestone *struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		State  string `json:"state"`
+	} `json:"milestone"`
+	Comments struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"comments"`
+	Labels        graphqlLabels `json:"labels"`
+	TimelineItems struct {
+		Nodes []struct {
+			Closer *graphqlIssueRef `json:"closer"`
+		} `json:"nodes"`
+	} `json:"timelineItems"`
+}
+
+// graphqlPullRequest is a pull request as returned by pullsQuery.
+type graphqlPullRequest struct {
+	Number    int          `json:"number"`
+	Title     string       `json:"title"`
+	Body      string       `json:"body"`
+	State     string       `json:"state"`
+	URL       string       `json:"url"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	ClosedAt  *time.Time   `json:"closedAt"`
+	MergedAt  *time.Time   `json:"mergedAt"`
+	Author    *graphqlUser `json:"author"`
+	Assignees struct {
+		Nodes []graphqlUser `json:"nodes"`
+	} `json:"assignees"`
+	Comments struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"comments"`
+	Labels                  graphqlLabels `json:"labels"`
+	ClosingIssuesReferences struct {
+		Nodes []graphqlIssueRef `json:"nodes"`
+	} `json:"closingIssuesReferences"`
+}
+
+const issuesQuery = `
+query($owner: String!, $repo: String!, $cursor: String, $since: DateTime, $orderBy: IssueOrderField!) {
+  repository(owner: $owner, name: $repo) {
+    issues(first: 100, after: $cursor, filterBy: {since: $since}, orderBy: {field: $orderBy, direction: DESC}) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number title body state url createdAt updatedAt closedAt
+        author { login }
+        assignees(first: 1) { nodes { login } }
+        milestone { number title state }
+        comments { totalCount }
+        labels(first: 100) { nodes { name color } }
+        timelineItems(last: 1, itemTypes: [CLOSED_EVENT]) {
+          nodes {
+            ... on ClosedEvent {
+              closer {
+                __typename
+                ... on PullRequest { number repository { nameWithOwner } }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+const pullsQuery = `
+query($owner: String!, $repo: String!, $cursor: String, $orderBy: IssueOrderField!) {
+  repository(owner: $owner, name: $repo) {
+    pullRequests(first: 100, after: $cursor, orderBy: {field: $orderBy, direction: DESC}) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number title body state url createdAt updatedAt closedAt mergedAt
+        author { login }
+        assignees(first: 1) { nodes { login } }
+        comments { totalCount }
+        labels(first: 100) { nodes { name color } }
+        closingIssuesReferences(first: 50) {
+          nodes { __typename number repository { nameWithOwner } }
+        }
+      }
+    }
+  }
+}`
+
+const issueLinksQuery = `
+query($owner: String!, $repo: String!, $cursor: String, $since: DateTime) {
+  repository(owner: $owner, name: $repo) {
+    issues(first: 100, after: $cursor, states: CLOSED, filterBy: {since: $since}, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number
+        timelineItems(last: 1, itemTypes: [CLOSED_EVENT]) {
+          nodes {
+            ... on ClosedEvent {
+              closer {
+                __typename
+                ... on PullRequest { number repository { nameWithOwner } }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+const pullLinksQuery = `
+query($owner: String!, $repo: String!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequests(first: 100, after: $cursor, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      totalCount
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number updatedAt
+        closingIssuesReferences(first: 50) {
+          nodes { __typename number repository { nameWithOwner } }
+        }
+      }
+    }
+  }
+}`
+
+// login returns the login of a user, or "ghost" (as used by the REST
+// API) for deleted users.
+func (u *graphqlUser) login() string {
+	if u == nil {
+		return "ghost"
+	}
+	return u.Login
+}
+
+// toIssue converts a GraphQL issue into the form returned by the REST
+// API.
+func (i graphqlIssue) toIssue(apiURL, owner, repo string) octokit.Issue {
+	issue := octokit.Issue{
+		URL:       fmt.Sprintf("%s/repos/%s/%s/issues/%d", apiURL, owner, repo, i.Number),
+		HTMLURL:   i.URL,
+		Number:    i.Number,
+		State:     strings.ToLower(i.State),
+		Title:     i.Title,
+		Body:      i.Body,
+		User:      octokit.User{Login: i.Author.login()},
+		Comments:  i.Comments.TotalCount,
+		CreatedAt: i.CreatedAt,
+		ClosedAt:  i.ClosedAt,
+		UpdatedAt: i.UpdatedAt,
+	}
+	for _, label := range i.Labels.Nodes {
+		issue.Labels = append(issue.Labels, struct {
+			URL   string `json:"url,omitempty"`
+			Name  string `json:"name,omitempty"`
+			Color string `json:"color,omitempty"`
+		}{Name: label.Name, Color: label.Color})
+	}
+	if len(i.Assignees.Nodes) > 0 {
+		issue.Assignee = octokit.User{Login: i.Assignees.Nodes[0].Login}
+	}
+	if i.Milestone != nil {
+		issue.Milestone.Number = i.Milestone.Number
+		issue.Milestone.Title = i.Milestone.Title
+		issue.Milestone.State = strings.ToLower(i.Milestone.State)
+	}
+	return issue
+}
+
+// links returns the pull request (if any) which closed this issue,
+// according to the issue's timeline.
+func (i graphqlIssue) links(owner, repo string) []issueLink {
+	var links []issueLink
+	for _, event := range i.TimelineItems.Nodes {
+		if event.Closer != nil && event.Closer.Typename == "PullRequest" {
+			links = append(links, issueLink{
+				IssueRepo: owner + "/" + repo,
+				Issue:     i.Number,
+				PullRepo:  event.Closer.Repository.NameWithOwner,
+				Pull:      event.Closer.Number,
+				Source:    linkFromClosedEvent,
+			})
+		}
+	}
+	return links
+}
+
+// toPullRequest converts a GraphQL pull request into the form returned
+// by the REST API.
+func (p graphqlPullRequest) toPullRequest(apiURL, owner, repo string) octokit.PullRequest {
+	pull := octokit.PullRequest{
+		URL:       fmt.Sprintf("%s/repos/%s/%s/pulls/%d", apiURL, owner, repo, p.Number),
+		HTMLURL:   p.URL,
+		IssueURL:  fmt.Sprintf("%s/repos/%s/%s/issues/%d", apiURL, owner, repo, p.Number),
+		Number:    p.Number,
+		State:     strings.ToLower(p.State),
+		Title:     p.Title,
+		Body:      p.Body,
+		User:      octokit.User{Login: p.Author.login()},
+		Comments:  p.Comments.TotalCount,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+		ClosedAt:  p.ClosedAt,
+		MergedAt:  p.MergedAt,
+		Merged:    p.MergedAt != nil,
+	}
+	// The REST API reports merged pull requests as closed.
+	if pull.State == "merged" {
+		pull.State = "closed"
+	}
+	if len(p.Assignees.Nodes) > 0 {
+		pull.Assignee = &octokit.User{Login: p.Assignees.Nodes[0].Login}
+	}
+	return pull
+}
+
+// links returns the issues which this pull request will close (or has
+// closed) when merged.
+func (p graphqlPullRequest) links(owner, repo string) []issueLink {
+	var links []issueLink
+	for _, ref := range p.ClosingIssuesReferences.Nodes {
+		links = append(links, issueLink{
+			IssueRepo: ref.Repository.NameWithOwner,
+			Issue:     ref.Number,
+			PullRepo:  owner + "/" + repo,
+			Pull:      p.Number,
+			Source:    linkFromClosingReference,
+		})
+	}
+	return links
+}
+
+// getAllIssuesGraphQL gets all issues (open and closed) on a github
+// repository via the GraphQL API, along with the pull requests which
+// closed them. If since is not the zero time, only issues updated on or
+// after that time are fetched.
+func getAllIssuesGraphQL(client *graphqlClient, owner, repo string, since time.Time, progress *fetchProgress) ([]octokit.Issue, []issueLink, error) {
+	var issues []octokit.Issue
+	var links []issueLink
+	variables := map[string]interface{}{
+		"owner":   owner,
+		"repo":    repo,
+		"orderBy": "CREATED_AT",
+	}
+	if !since.IsZero() {
+		variables["since"] = since.UTC().Format(time.RFC3339)
+		variables["orderBy"] = "UPDATED_AT"
+	}
+	for {
+		var result struct {
+			Repository struct {
+				Issues struct {
+					TotalCount int             `json:"totalCount"`
+					PageInfo   graphqlPageInfo `json:"pageInfo"`
+					Nodes      []graphqlIssue  `json:"nodes"`
+				} `json:"issues"`
+			} `json:"repository"`
+		}
+		err := client.query(issuesQuery, variables, &result)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to fetch issues for %s/%s: %w", owner, repo, err)
+		}
+		page := result.Repository.Issues
+		for _, node := range page.Nodes {
+			issues = append(issues, node.toIssue(client.apiURL, owner, repo))
+			links = append(links, node.links(owner, repo)...)
+		}
+		progress.update("issues", len(issues), page.TotalCount)
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = page.PageInfo.EndCursor
+	}
+	return issues, links, nil
+}
+
+// getAllPullRequestsGraphQL gets all pull requests on a github
+// repository via the GraphQL API, along with the issues which they
+// close. If since is not the zero time, only pull requests updated on or
+// after that time are fetched.
+func getAllPullRequestsGraphQL(client *graphqlClient, owner, repo string, since time.Time, progress *fetchProgress) ([]octokit.PullRequest, []issueLink, error) {
+	var pulls []octokit.PullRequest
+	var links []issueLink
+	variables := map[string]interface{}{
+		"owner":   owner,
+		"repo":    repo,
+		"orderBy": "CREATED_AT",
+	}
+	// As with the REST API, pull requests cannot be filtered by update
+	// time, so in incremental mode we fetch the most recently updated
+	// pull requests first and stop when we reach an older one.
+	incremental := !since.IsZero()
+	if incremental {
+		variables["orderBy"] = "UPDATED_AT"
+	}
+	for {
+		var result struct {
+			Repository struct {
+				PullRequests struct {
+					TotalCount int                  `json:"totalCount"`
+					PageInfo   graphqlPageInfo      `json:"pageInfo"`
+					Nodes      []graphqlPullRequest `json:"nodes"`
+				} `json:"pullRequests"`
+			} `json:"repository"`
+		}
+		err := client.query(pullsQuery, variables, &result)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to fetch pull requests for %s/%s: %w", owner, repo, err)
+		}
+		page := result.Repository.PullRequests
+		done := false
+		for _, node := range page.Nodes {
+			if incremental && node.UpdatedAt.Before(since) {
+				done = true
+				break
+			}
+			pulls = append(pulls, node.toPullRequest(client.apiURL, owner, repo))
+			links = append(links, node.links(owner, repo)...)
+		}
+		progress.update("pull requests", len(pulls), page.TotalCount)
+		if done || !page.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = page.PageInfo.EndCursor
+	}
+	return pulls, links, nil
+}
+
+// getLinksGraphQL gets the links between the issues and pull requests on
+// a github repository via the GraphQL API, without fetching the issues
+// and pull requests themselves. If since is not the zero time, only the
+// links of issues and pull requests updated on or after that time are
+// fetched.
+func getLinksGraphQL(client *graphqlClient, owner, repo string, since time.Time, progress *fetchProgress) ([]issueLink, error) {
+	var links []issueLink
+	variables := map[string]interface{}{
+		"owner": owner,
+		"repo":  repo,
+	}
+	if !since.IsZero() {
+		variables["since"] = since.UTC().Format(time.RFC3339)
+	}
+	for done := 0; ; {
+		var result struct {
+			Repository struct {
+				Issues struct {
+					TotalCount int             `json:"totalCount"`
+					PageInfo   graphqlPageInfo `json:"pageInfo"`
+					Nodes      []graphqlIssue  `json:"nodes"`
+				} `json:"issues"`
+			} `json:"repository"`
+		}
+		err := client.query(issueLinksQuery, variables, &result)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch issue links for %s/%s: %w", owner, repo, err)
+		}
+		page := result.Repository.Issues
+		for _, node := range page.Nodes {
+			links = append(links, node.links(owner, repo)...)
+		}
+		done += len(page.Nodes)
+		progress.update("issue links", done, page.TotalCount)
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = page.PageInfo.EndCursor
+	}
+
+	// As in getAllPullRequestsGraphQL, pull requests are fetched in
+	// order of update time, stopping at the first one updated before
+	// since.
+	delete(variables, "since")
+	delete(variables, "cursor")
+	for done := 0; ; {
+		var result struct {
+			Repository struct {
+				PullRequests struct {
+					TotalCount int                  `json:"totalCount"`
+					PageInfo   graphqlPageInfo      `json:"pageInfo"`
+					Nodes      []graphqlPullRequest `json:"nodes"`
+				} `json:"pullRequests"`
+			} `json:"repository"`
+		}
+		err := client.query(pullLinksQuery, variables, &result)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch pull request links for %s/%s: %w", owner, repo, err)
+		}
+		page := result.Repository.PullRequests
+		stop := false
+		for _, node := range page.Nodes {
+			if !since.IsZero() && node.UpdatedAt.Before(since) {
+				stop = true
+				break
+			}
+			links = append(links, node.links(owner, repo)...)
+			done++
+		}
+		progress.update("pull request links", done, page.TotalCount)
+		if stop || !page.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = page.PageInfo.EndCursor
+	}
+	return links, nil
+}
+
+// getDataFromGraphQL gets all issues and pull requests on a github
+// repository, and the links between them, via the GraphQL API. Issues
+// and pull requests are fetched concurrently.
+func getDataFromGraphQL(client *graphqlClient, owner, repo string, since time.Time, showProgress bool) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error) {
+	progress := newFetchProgress(showProgress)
+	var issues []octokit.Issue
+	var pulls []octokit.PullRequest
+	var issueLinks, pullLinks []issueLink
+	var issuesErr, pullsErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		issues, issueLinks, issuesErr = getAllIssuesGraphQL(client, owner, repo, since, progress)
+	}()
+	go func() {
+		defer wg.Done()
+		pulls, pullLinks, pullsErr = getAllPullRequestsGraphQL(client, owner, repo, since, progress)
+	}()
+	wg.Wait()
+	progress.finish()
+
+	if issuesErr != nil {
+		return nil, nil, nil, issuesErr
+	}
+	if pullsErr != nil {
+		return nil, nil, nil, pullsErr
+	}
+	return issues, pulls, append(issueLinks, pullLinks...), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// graphqlRequest is the body of a request to the GraphQL API.
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// newTestGraphQLClient starts a server which handles GraphQL requests
+// with respond, which returns the body of the response, and returns a
+// client for it.
+func newTestGraphQLClient(t *testing.T, respond func(graphqlRequest) string) *graphqlClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		if r.Method != http.MethodPost || r.URL.Path != "/graphql" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, respond(req))
+	}))
+	t.Cleanup(server.Close)
+	useTestSettings(t, server.URL)
+	return newGraphQLClientWith(server.URL+"/graphql", server.URL+"/", nil, http.DefaultTransport)
+}
+
+const testIssuesPage1 = `{"data": {"repository": {"issues": {
+	"totalCount": 2,
+	"pageInfo": {"hasNextPage": true, "endCursor": "cursor1"},
+	"nodes": [{
+		"number": 12, "title": "Crash", "body": "It crashed", "state": "CLOSED",
+		"url": "https://github.com/owner/repo/issues/12",
+		"createdAt": "2024-01-02T03:04:05Z", "updatedAt": "2024-02-01T00:00:00Z", "closedAt": "2024-02-01T00:00:00Z",
+		"author": {"login": "alice"},
+		"assignees": {"nodes": [{"login": "bob"}]},
+		"milestone": {"number": 3, "title": "v1.0", "state": "OPEN"},
+		"comments": {"totalCount": 4},
+		"labels": {"nodes": [{"name": "bug", "color": "ff0000"}]},
+		"timelineItems": {"nodes": [{"closer": {"__typename": "PullRequest", "number": 13, "repository": {"nameWithOwner": "owner/repo"}}}]}
+	}]
+}}}}`
+
+const testIssuesPage2 = `{"data": {"repository": {"issues": {
+	"totalCount": 2,
+	"pageInfo": {"hasNextPage": false, "endCursor": "cursor2"},
+	"nodes": [{
+		"number": 11, "title": "Old", "body": "", "state": "OPEN",
+		"url": "https://github.com/owner/repo/issues/11",
+		"createdAt": "2023-01-01T00:00:00Z", "updatedAt": "2023-01-01T00:00:00Z", "closedAt": null,
+		"author": null,
+		"assignees": {"nodes": []},
+		"milestone": null,
+		"comments": {"totalCount": 0},
+		"labels": {"nodes": []},
+		"timelineItems": {"nodes": []}
+	}]
+}}}}`
+
+const testPulls = `{"data": {"repository": {"pullRequests": {
+	"totalCount": 1,
+	"pageInfo": {"hasNextPage": false, "endCursor": "cursor1"},
+	"nodes": [{
+		"number": 13, "title": "Fix crash", "body": "Resolves #12", "state": "MERGED",
+		"url": "https://github.com/owner/repo/pull/13",
+		"createdAt": "2024-01-03T00:00:00Z", "updatedAt": "2024-02-01T00:00:00Z",
+		"closedAt": "2024-02-01T00:00:00Z", "mergedAt": "2024-02-01T00:00:00Z",
+		"author": {"login": "bob"},
+		"assignees": {"nodes": [{"login": "carol"}]},
+		"comments": {"totalCount": 1},
+		"labels": {"nodes": []},
+		"closingIssuesReferences": {"nodes": [{"__typename": "Issue", "number": 12, "repository": {"nameWithOwner": "owner/repo"}}]}
+	}]
+}}}}`
+
+func TestGetDataFromGraphQL(t *testing.T) {
+	var mutex sync.Mutex
+	var cursors []interface{}
+	client := newTestGraphQLClient(t, func(req graphqlRequest) string {
+		if strings.Contains(req.Query, "pullRequests(") {
+			return testPulls
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		cursors = append(cursors, req.Variables["cursor"])
+		if req.Variables["cursor"] == "cursor1" {
+			return testIssuesPage2
+		}
+		return testIssuesPage1
+	})
+
+	issues, pulls, links, err := getDataFromGraphQL(client, "owner", "repo", time.Time{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(cursors) != "[<nil> cursor1]" {
+		t.Errorf("got cursors %v, want [<nil> cursor1]", cursors)
+	}
+	if len(issues) != 2 || len(pulls) != 1 {
+		t.Fatalf("got %d issues and %d pulls, want 2 and 1", len(issues), len(pulls))
+	}
+
+	issue := issues[0]
+	closedAt := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	if issue.Number != 12 || issue.State != "closed" || issue.Title != "Crash" || issue.Body != "It crashed" {
+		t.Errorf("got issue %d %q (%s) %q", issue.Number, issue.Title, issue.State, issue.Body)
+	}
+	if want := client.apiURL + "/repos/owner/repo/issues/12"; issue.URL != want {
+		t.Errorf("got issue URL %s, want %s", issue.URL, want)
+	}
+	if issue.HTMLURL != "https://github.com/owner/repo/issues/12" {
+		t.Errorf("got issue HTML URL %s", issue.HTMLURL)
+	}
+	if issue.User.Login != "alice" || issue.Assignee.Login != "bob" || issue.Comments != 4 {
+		t.Errorf("got author %s, assignee %s and %d comments", issue.User.Login, issue.Assignee.Login, issue.Comments)
+	}
+	if issue.ClosedAt == nil || !issue.ClosedAt.Equal(closedAt) {
+		t.Errorf("got closed at %v, want %v", issue.ClosedAt, closedAt)
+	}
+	if issue.Milestone.Title != "v1.0" || issue.Milestone.State != "open" {
+		t.Errorf("got milestone %q (%s)", issue.Milestone.Title, issue.Milestone.State)
+	}
+	if len(issue.Labels) != 1 || issue.Labels[0].Name != "bug" || issue.Labels[0].Color != "ff0000" {
+		t.Errorf("got labels %v", issue.Labels)
+	}
+	if ghost := issues[1]; ghost.User.Login != "ghost" || ghost.ClosedAt != nil || ghost.Assignee.Login != "" {
+		t.Errorf("got author %q and assignee %q for an issue by a deleted user", ghost.User.Login, ghost.Assignee.Login)
+	}
+
+	pull := pulls[0]
+	if pull.Number != 13 || pull.State != "closed" || !pull.Merged || pull.MergedAt == nil || pullState(pull) != pullMerged {
+		t.Errorf("got pull %d (%s, merged %v)", pull.Number, pull.State, pull.Merged)
+	}
+	if want := client.apiURL + "/repos/owner/repo/pulls/13"; pull.URL != want {
+		t.Errorf("got pull URL %s, want %s", pull.URL, want)
+	}
+	if want := client.apiURL + "/repos/owner/repo/issues/13"; pull.IssueURL != want {
+		t.Errorf("got pull issue URL %s, want %s", pull.IssueURL, want)
+	}
+	if pull.User.Login != "bob" || pull.Assignee == nil || pull.Assignee.Login != "carol" {
+		t.Errorf("got author %s and assignee %v", pull.User.Login, pull.Assignee)
+	}
+
+	want := []issueLink{
+		{IssueRepo: "owner/repo", Issue: 12, PullRepo: "owner/repo", Pull: 13, Source: linkFromClosedEvent},
+		{IssueRepo: "owner/repo", Issue: 12, PullRepo: "owner/repo", Pull: 13, Source: linkFromClosingReference},
+	}
+	if fmt.Sprint(links) != fmt.Sprint(want) {
+		t.Errorf("got links %v, want %v", links, want)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	client := newTestGraphQLClient(t, func(graphqlRequest) string {
+		return `{"data": null, "errors": [{"message": "Could not resolve to a Repository"}, {"message": "Second error"}]}`
+	})
+	_, _, _, err := getDataFromGraphQL(client, "owner", "missing", time.Time{}, false)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "Could not resolve to a Repository; Second error") {
+		t.Errorf("got error %q, which doesn't include the GraphQL errors", err)
+	}
+}
+
+const testIssueLinks = `{"data": {"repository": {"issues": {
+	"totalCount": 1,
+	"pageInfo": {"hasNextPage": false, "endCursor": "cursor1"},
+	"nodes": [{"number": 12, "timelineItems": {"nodes": [{"closer": {"__typename": "PullRequest", "number": 13, "repository": {"nameWithOwner": "owner/repo"}}}]}}]
+}}}}`
+
+const testPullLinks = `{"data": {"repository": {"pullRequests": {
+	"totalCount": 2,
+	"pageInfo": {"hasNextPage": true, "endCursor": "cursor1"},
+	"nodes": [
+		{"number": 13, "updatedAt": "2024-02-01T00:00:00Z", "closingIssuesReferences": {"nodes": [{"__typename": "Issue", "number": 12, "repository": {"nameWithOwner": "owner/repo"}}]}},
+		{"number": 10, "updatedAt": "2023-02-01T00:00:00Z", "closingIssuesReferences": {"nodes": [{"__typename": "Issue", "number": 9, "repository": {"nameWithOwner": "owner/repo"}}]}}
+	]
+}}}}`
+
+func TestRESTFetcherLinks(t *testing.T) {
+	var graphqlRequests []graphqlRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		if json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		graphqlRequests = append(graphqlRequests, req)
+		if strings.Contains(req.Query, "pullRequests(") {
+			fmt.Fprint(w, testPullLinks)
+		} else {
+			fmt.Fprint(w, testIssueLinks)
+		}
+	})
+	mux.HandleFunc("/repos/owner/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		writeIssues(w, 12)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "[]")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	useTestSettings(t, server.URL)
+	f := restFetcher{
+		client: newClientWith(server.URL, nil, http.DefaultTransport),
+		links:  newGraphQLClientWith(server.URL+"/graphql", server.URL, nil, http.DefaultTransport),
+	}
+
+	since := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	issues, _, links, err := f.fetch("owner", "repo", since, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 {
+		t.Errorf("got %d issues, want 1", len(issues))
+	}
+	// The second page of pull requests isn't needed, as the last pull
+	// request on the first page was updated before since.
+	if len(graphqlRequests) != 2 || graphqlRequests[0].Variables["since"] != "2024-01-15T00:00:00Z" {
+		t.Errorf("got GraphQL requests %v, want one for issues updated since %v and one for pull requests", graphqlRequests, since)
+	}
+	want := []issueLink{
+		{IssueRepo: "owner/repo", Issue: 12, PullRepo: "owner/repo", Pull: 13, Source: linkFromClosedEvent},
+		{IssueRepo: "owner/repo", Issue: 12, PullRepo: "owner/repo", Pull: 13, Source: linkFromClosingReference},
+	}
+	if fmt.Sprint(links) != fmt.Sprint(want) {
+		t.Errorf("got links %v, want %v", links, want)
+	}
+}
+
+func TestRESTFetcherLinksUnavailable(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		writeIssues(w, 12)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"number": 13, "body": "Fixes #12"}]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	useTestSettings(t, server.URL)
+	f := restFetcher{
+		client: newClientWith(server.URL, nil, http.DefaultTransport),
+		links:  newGraphQLClientWith(server.URL+"/graphql", server.URL, nil, http.DefaultTransport),
+	}
+
+	// The links are left to the closing keyword parser, rather than
+	// failing the fetch.
+	issues, pulls, links, err := f.fetch("owner", "repo", time.Time{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || len(pulls) != 1 || links != nil {
+		t.Errorf("got %d issues, %d pull requests and links %v, want 1, 1 and no links", len(issues), len(pulls), links)
+	}
+}
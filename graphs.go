@@ -2,127 +2,316 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/octokit/go-octokit/octokit"
 )
 
+// graphData holds the data from which graphs are drawn.
+type graphData struct {
+	// issues are the issues opened within the date window.
+	issues []octokit.Issue
+	// openedPulls are the pull requests opened within the date window.
+	openedPulls []octokit.PullRequest
+	// mergedPulls are the pull requests merged within the date window.
+	mergedPulls []octokit.PullRequest
+}
+
+// namedGraph is a graph which can be selected by name on the command
+// line. The name of a graph is the name of its file, without the
+// extension.
+type namedGraph struct {
+	name        string
+	description string
+	// params are the command line options which control the graph (in
+	// addition to the global options such as --since).
+	params []string
+	draw   func(data graphData, fileName string) error
+}
+
+// allGraphs lists all graphs, in the order in which they are drawn.
+var allGraphs = []namedGraph{
+	{
+		name:        "bugs",
+		description: "Cumulative bugs fixed over time by a user",
+		params:      []string{"--username"},
+		draw: func(d graphData, fileName string) error {
+			return graphBugFixRate(d.mergedPulls, settings.Username, fileName)
+		},
+	},
+	{
+		name:        "openIssues",
+		description: "Number of open bugs over time",
+		draw: func(d graphData, fileName string) error {
+			return graphIssuesByDate(d.issues, fileName)
+		},
+	},
+	{
+		name:        "openPullRequests",
+		description: "Number of open pull requests over time",
+		draw: func(d graphData, fileName string) error {
+			return graphPullRequestsByDate(d.openedPulls, fileName)
+		},
+	},
+	{
+		name:        "openedVsClosed",
+		description: "Total issues closed against total issues opened",
+		draw: func(d graphData, fileName string) error {
+			return graphOpenedVsClosed(d.issues, fileName)
+		},
+	},
+	{
+		name:        "closedByUser",
+		description: "Total issues opened and closed since a user's first bugfix",
+		params:      []string{"--username"},
+		draw: func(d graphData, fileName string) error {
+			return graphOpenedVsClosedForUser(d.issues, d.mergedPulls, settings.Username, fileName)
+		},
+	},
+	{
+		name:        "fixersComparison",
+		description: "Total issues opened and closed, and bugs fixed by each of several users",
+		params:      []string{"--compare-user", "--team-file"},
+		draw: func(d graphData, fileName string) error {
+			return graphOpenedVsClosedForUsers(d.issues, d.mergedPulls, fileName, parsed.compareUsers...)
+		},
+	},
+	{
+		name:        "fixersComparisonByBugCount",
+		description: "Bugs fixed over time by each user who has fixed a minimum number of bugs",
+		params:      []string{"--min-bugs-fixed"},
+		draw: func(d graphData, fileName string) error {
+			return graphBugfixRateByUser(d.issues, d.mergedPulls, fileName, settings.GraphOptions.MinBugsFixed)
+		},
+	},
+	{
+		name:        "allfixersComparison",
+		description: "Bugs fixed over time by every user",
+		draw: func(d graphData, fileName string) error {
+			return graphBugfixRateByUser(d.issues, d.mergedPulls, fileName, -1)
+		},
+	},
+	{
+		name:        "issuesOpenedByUser",
+		description: "Number of issues opened by each user who has opened more than a minimum number of issues",
+		params:      []string{"--min-issues-opened"},
+		draw: func(d graphData, fileName string) error {
+			return graphIssuesOpenedByUser(d.issues, settings.GraphOptions.MinIssuesOpened, fileName)
+		},
+	},
+}
+
+// listGraphs prints the names and descriptions of all graphs.
+func listGraphs() {
+	for _, graph := range allGraphs {
+		fmt.Printf("%-28s%s\n", graph.name, graph.description)
+		if len(graph.params) > 0 {
+			fmt.Printf("%-28s(options: %s)\n", "", strings.Join(graph.params, ", "))
+		}
+	}
+}
+
+// selectedGraphs returns the graphs with the given names. If no names
+// are given, the graphs selected by the --graphs option are returned, or
+// all graphs if that option is not given.
+func selectedGraphs(names []string) ([]namedGraph, error) {
+	if len(names) == 0 && settings.GraphOptions.Graphs != "" {
+		names = strings.Split(settings.GraphOptions.Graphs, ",")
+	}
+	return findGraphs(names)
+}
+
+// findGraphs returns the graphs with the given names, in the order in
+// which they are given. Returns all graphs if no names are given.
+func findGraphs(names []string) ([]namedGraph, error) {
+	if len(names) == 0 {
+		return allGraphs, nil
+	}
+	var graphs []namedGraph
+	for _, name := range names {
+		found := false
+		name = strings.TrimSpace(name)
+		for _, graph := range allGraphs {
+			if graph.name == name {
+				graphs = append(graphs, graph)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown graph '%s'", name)
+		}
+	}
+	return graphs, nil
+}
+
+// graphTitle prefixes a graph title with the name of the github
+// repositories which are being graphed.
+func graphTitle(title string) string {
+	return fmt.Sprintf("%s: %s", parsed.repositoryNames(), title)
+}
+
 // graphBugFixRate graphs the cumulative number of bugs fixed by a user
 // over time.
-func graphBugFixRate(allPulls []octokit.PullRequest, username, graphFileName string) {
-	bugFixRate := getBugFixRate(allPulls, username)
-	title := fmt.Sprintf("Cumulative bugs fixed over time by %s", username)
+func graphBugFixRate(allPulls []octokit.PullRequest, username, graphFileName string) error {
+	title := graphTitle(fmt.Sprintf("Cumulative bugs fixed over time by %s", username))
 
-	data := seriesFromMap(title, bugFixRate)
+	var data []series
+	for _, group := range groupByRepository(nil, allPulls) {
+		data = append(data, seriesFromMap(
+			group.seriesName(fmt.Sprintf("Total fixed by %s", username)),
+			getBugFixRate(group.pulls, username)))
+	}
 
-	createLinePlot(
+	err := createLinePlot(
 		title,
 		"Date",
 		"Total Number of Issues Resolved",
 		graphFileName,
-		data)
+		data...)
+	if err != nil {
+		return err
+	}
+	bugFixRate := getBugFixRate(allPulls, username)
 	if bugFixRate != nil {
 		fmt.Printf("%s has resolved %d issues.\n", username, bugFixRate[getLastDate(bugFixRate)])
 	}
+	return nil
 }
 
 // graphIssuesByDate graphs the number of open bugs over time.
-func graphIssuesByDate(issues []octokit.Issue, graphFileName string) {
-	// Generate a map of issues over time.
-	issuesOpenedByDate := getOpenIssuesByDate(issues)
+func graphIssuesByDate(issues []octokit.Issue, graphFileName string) error {
+	title := graphTitle("Change in number of open bugs over time")
 
-	title := "Change in number of open bugs over time"
+	// Generate a map of issues over time.
+	var data []series
+	for _, group := range groupByRepository(issues, nil) {
+		data = append(data, seriesFromMap(
+			group.seriesName("Open bugs"),
+			getOpenIssuesByDate(group.issues)))
+	}
 
-	createLinePlot(
+	return createLinePlot(
 		title,
 		"Date",
 		"Number of open bugs",
 		graphFileName,
-		seriesFromMap(title, issuesOpenedByDate))
+		data...)
+}
+
+// graphPullRequestsByDate graphs the number of open pull requests over
+// time.
+func graphPullRequestsByDate(pulls []octokit.PullRequest, graphFileName string) error {
+	title := graphTitle("Change in number of open pull requests over time")
+
+	var data []series
+	for _, group := range groupByRepository(nil, pulls) {
+		data = append(data, seriesFromMap(
+			group.seriesName("Open pull requests"),
+			getOpenPullRequestsByDate(group.pulls)))
+	}
+
+	return createLinePlot(
+		title,
+		"Date",
+		"Number of open pull requests",
+		graphFileName,
+		data...)
 }
 
 // graphOpenedVsClosed graphs two series:
 // 1. Cumulative number of issues opened over time.
 // 2. Cumulative number of issues closed over time.
-func graphOpenedVsClosed(issues []octokit.Issue, graphFileName string) {
-	// Generate a map of issues over time.
-	opened := seriesFromMap("Total issues opened",
-		getCumOpenIssuesByDate(issues))
-	closed := seriesFromMap("Total issues closed",
-		getCumIssuesClosedByDate(issues))
-
-	openedVsClosed := createIntSeries(opened, closed, "Issues open/close rate")
-	oneToOneLine := intSeries{
-		X:    openedVsClosed.X,
-		Y:    openedVsClosed.X,
-		Name: "1:1 line",
-	}
-	createLinePlot(
-		"Total issues opened and closed over time",
+func graphOpenedVsClosed(issues []octokit.Issue, graphFileName string) error {
+	var data []series
+	oneToOneLine := intSeries{Name: "1:1 line"}
+	for _, group := range groupByRepository(issues, nil) {
+		// Generate a map of issues over time.
+		opened := seriesFromMap("Total issues opened",
+			getCumOpenIssuesByDate(group.issues))
+		closed := seriesFromMap("Total issues closed",
+			getCumIssuesClosedByDate(group.issues))
+
+		openedVsClosed := createIntSeries(opened, closed, group.seriesName("Issues open/close rate"))
+		data = append(data, openedVsClosed)
+		oneToOneLine.X = append(oneToOneLine.X, openedVsClosed.X...)
+	}
+	oneToOneLine.Y = oneToOneLine.X
+	data = append(data, oneToOneLine)
+
+	return createLinePlot(
+		graphTitle("Total issues opened and closed over time"),
 		"Total Issues Opened",
 		"Total Issues Closed",
 		graphFileName,
-		openedVsClosed,
-		oneToOneLine)
+		data...)
 }
 
 // graphOpenedVsClosed graphs three series:
 // 1. Cumulative number of issues opened over time.
 // 2. Cumulative number of issues closed over time.
 // 3. Cumulative number of issues fixed over time by a given user.
-func graphOpenedVsClosedForUser(issues []octokit.Issue, pulls []octokit.PullRequest, userName, graphFileName string) {
-	bugFixRate := getBugFixRate(pulls, userName)
-	fixedSeries := seriesFromMap(
-		fmt.Sprintf("Total fixed by %s", userName),
-		bugFixRate)
-
-	// We only want to graph data on or after the date of the first bug fixed by the user.
-	dateFirstBugfix := getFirstDate(bugFixRate)
-	openedAfterDate := filterIssues(issues, func(issue octokit.Issue) bool {
-		return issue.CreatedAt.After(dateFirstBugfix) || issue.CreatedAt == dateFirstBugfix
-	})
-	closedAfterDate := filterIssues(issues, func(issue octokit.Issue) bool {
-		return issue.ClosedAt != nil &&
-			((*issue.ClosedAt).After(dateFirstBugfix) || *issue.ClosedAt == dateFirstBugfix)
-	})
+func graphOpenedVsClosedForUser(issues []octokit.Issue, pulls []octokit.PullRequest, userName, graphFileName string) error {
+	var data []series
+	for _, group := range groupByRepository(issues, pulls) {
+		bugFixRate := getBugFixRate(group.pulls, userName)
+		fixedSeries := seriesFromMap(
+			group.seriesName(fmt.Sprintf("Total fixed by %s", userName)),
+			bugFixRate)
+
+		// We only want to graph data on or after the date of the first bug fixed by the user.
+		dateFirstBugfix := getFirstDate(bugFixRate)
+		openedAfterDate := filterIssues(group.issues, func(issue octokit.Issue) bool {
+			return issue.CreatedAt.After(dateFirstBugfix) || issue.CreatedAt == dateFirstBugfix
+		})
+		closedAfterDate := filterIssues(group.issues, func(issue octokit.Issue) bool {
+			return issue.ClosedAt != nil &&
+				((*issue.ClosedAt).After(dateFirstBugfix) || *issue.ClosedAt == dateFirstBugfix)
+		})
 
-	// Generate a map of cumulative issues opened and closed over time.
-	opened := seriesFromMap("Total issues opened", getCumOpenIssuesByDate(openedAfterDate))
-	closed := seriesFromMap("Total issues closed", getCumIssuesClosedByDate(closedAfterDate))
+		// Generate a map of cumulative issues opened and closed over time.
+		opened := seriesFromMap(group.seriesName("Total issues opened"), getCumOpenIssuesByDate(openedAfterDate))
+		closed := seriesFromMap(group.seriesName("Total issues closed"), getCumIssuesClosedByDate(closedAfterDate))
 
-	createLinePlot(
-		fmt.Sprintf("Total issues opened and closed over time since %s's first bugfix", userName),
+		data = append(data, opened, closed, fixedSeries)
+	}
+
+	return createLinePlot(
+		graphTitle(fmt.Sprintf("Total issues opened and closed over time since %s's first bugfix", userName)),
 		"Date",
 		"Number of open bugs",
 		graphFileName,
-		opened,
-		closed,
-		fixedSeries)
+		data...)
 }
 
 // graphOpenedVsClosedForUsers graphs many series:
 // 1. Cumulative number of issues opened over time.
 // 2. Cumulative number of issues closed over time.
 // 3. Cumulative number of issues fixed over time for each user.
-func graphOpenedVsClosedForUsers(issues []octokit.Issue, pulls []octokit.PullRequest, graphFileName string, users ...string) {
-	// Get data for issues fixed for each user.
-	var userSeries []series
-	for _, userName := range users {
-		newSeries := seriesFromMap(
-			fmt.Sprintf("Total fixed by %s", userName),
-			getBugFixRate(pulls, userName))
-		userSeries = append(userSeries, newSeries)
-	}
-	// Generate a map of cumulative issues opened and closed over time.
-	opened := seriesFromMap("Total issues opened",
-		getCumOpenIssuesByDate(issues))
-	allSeries := append(userSeries, opened)
-
-	closed := seriesFromMap("Total issues closed",
-		getCumIssuesClosedByDate(issues))
-	allSeries = append(allSeries, closed)
-
-	createLinePlot(
-		"Total issues opened and closed over time",
+func graphOpenedVsClosedForUsers(issues []octokit.Issue, pulls []octokit.PullRequest, graphFileName string, users ...string) error {
+	var allSeries []series
+	for _, group := range groupByRepository(issues, pulls) {
+		// Get data for issues fixed for each user.
+		for _, userName := range users {
+			newSeries := seriesFromMap(
+				group.seriesName(fmt.Sprintf("Total fixed by %s", userName)),
+				getBugFixRate(group.pulls, userName))
+			allSeries = append(allSeries, newSeries)
+		}
+		// Generate a map of cumulative issues opened and closed over time.
+		opened := seriesFromMap(group.seriesName("Total issues opened"),
+			getCumOpenIssuesByDate(group.issues))
+		allSeries = append(allSeries, opened)
+
+		closed := seriesFromMap(group.seriesName("Total issues closed"),
+			getCumIssuesClosedByDate(group.issues))
+		allSeries = append(allSeries, closed)
+	}
+
+	return createLinePlot(
+		graphTitle("Total issues opened and closed over time"),
 		"Date",
 		"Number of bugs",
 		graphFileName,
@@ -133,40 +322,46 @@ func graphOpenedVsClosedForUsers(issues []octokit.Issue, pulls []octokit.PullReq
 // 1. Cumulative number of issues opened over time.
 // 2. Cumulative number of issues closed over time.
 // 3. Cumulative number of issues fixed over time for each user who has
-//    fixed at least a given number of issues.
-func graphBugfixRateByUser(issues []octokit.Issue, pulls []octokit.PullRequest, graphFileName string, minN int) {
-	// Get data for issues fixed for each user.
+//    fixed at least a given number of issues, excluding bots.
+func graphBugfixRateByUser(issues []octokit.Issue, pulls []octokit.PullRequest, graphFileName string, minN int) error {
 	var userSeries []series
-	dataByUser := pullsGroupedByUser(pulls)
+	for _, group := range groupByRepository(issues, pulls) {
+		// Get data for issues fixed for each user.
+		dataByUser := pullsGroupedByUser(group.pulls)
 
-	for user := range dataByUser {
-		// Generate a map of dates to number of issues referenced in pull requests.
-		issuesByDate := getCumIssuesByDate(dataByUser[user])
+		for user := range dataByUser {
+			if isBot(user) {
+				continue
+			}
 
-		// Only graph data for this user if they have fixed at least `minN` bugs.
-		numBugs := issuesByDate[getLastDate(issuesByDate)]
-		if numBugs >= minN {
-			seriesTitle := user
-			userSeries = append(userSeries, seriesFromMap(seriesTitle, issuesByDate))
+			// Generate a map of dates to number of issues referenced in pull requests.
+			issuesByDate := getCumIssuesByDate(dataByUser[user])
+
+			// Only graph data for this user if they have fixed at least `minN` bugs.
+			numBugs := issuesByDate[getLastDate(issuesByDate)]
+			if numBugs >= minN {
+				seriesTitle := group.seriesName(user)
+				userSeries = append(userSeries, seriesFromMap(seriesTitle, issuesByDate))
+			}
 		}
-	}
 
-	// Add a series for stale bot
-	fixedByStaleBot := issuesFixedByStaleBot(issues)
-	issuesByDate := getCumIssuesClosedByDate(fixedByStaleBot)
-	userSeries = append(userSeries, seriesFromMap("StaleBot", issuesByDate))
+		// Add a series for stale bot
+		fixedByStaleBot := issuesFixedByStaleBot(group.issues)
+		issuesByDate := getCumIssuesClosedByDate(fixedByStaleBot)
+		userSeries = append(userSeries, seriesFromMap(group.seriesName("StaleBot"), issuesByDate))
 
-	// Generate a map of cumulative issues opened and closed over time.
-	opened := seriesFromMap("Total issues opened",
-		getCumOpenIssuesByDate(issues))
-	userSeries = append(userSeries, opened)
+		// Generate a map of cumulative issues opened and closed over time.
+		opened := seriesFromMap(group.seriesName("Total issues opened"),
+			getCumOpenIssuesByDate(group.issues))
+		userSeries = append(userSeries, opened)
 
-	closed := seriesFromMap("Total issues closed",
-		getCumIssuesClosedByDate(issues))
-	userSeries = append(userSeries, closed)
+		closed := seriesFromMap(group.seriesName("Total issues closed"),
+			getCumIssuesClosedByDate(group.issues))
+		userSeries = append(userSeries, closed)
+	}
 
-	createLinePlot(
-		fmt.Sprintf("Bugs fixed over time for all users who have fixed at least %d bugs", minN),
+	return createLinePlot(
+		graphTitle(fmt.Sprintf("Bugs fixed over time for all users who have fixed at least %d bugs", minN)),
 		"Date",
 		"Number of bugs",
 		graphFileName,
@@ -175,25 +370,44 @@ func graphBugfixRateByUser(issues []octokit.Issue, pulls []octokit.PullRequest,
 
 // Create a bar graph of users (x-axis) vs num issues opened by that user
 // (on the y-axis), for all useres who have fixed at least a certain number
-// of issues.
-func graphIssuesOpenedByUser(issues []octokit.Issue, issueThresholdPerUser int, graphFileName string) {
-	groups := getIssuesGroupedByAuthor(issues)
-	groups = filterIssueGroup(groups, func(issues []octokit.Issue) bool {
+// of issues. Bots are excluded.
+func graphIssuesOpenedByUser(issues []octokit.Issue, issueThresholdPerUser int, graphFileName string) error {
+	// Only show users who have opened more than the threshold number of
+	// issues across all repositories.
+	authors := filterIssueGroup(getIssuesGroupedByAuthor(issues), func(issues []octokit.Issue) bool {
 		return len(issues) > issueThresholdPerUser
 	})
+	var users []string
+	for user := range authors {
+		if !isBot(user) {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	if len(users) == 0 {
+		// A bar chart needs at least one bar, and this graph is no reason
+		// not to draw the others.
+		fmt.Fprintf(os.Stderr, "Warning: skipping graph '%s': no user has opened more than %d issues\n",
+			graphFileName, issueThresholdPerUser)
+		return nil
+	}
 
-	// Split into 2 series - opened and closed
-	open := filterIssueGroupIssues(groups, isOpen)
-	closed := filterIssueGroupIssues(groups, isClosed)
+	// Split each repository group into 2 series - opened and closed
+	var data []barSeries
+	for _, group := range groupByRepository(issues, nil) {
+		groups := getIssuesGroupedByAuthor(group.issues)
+		open := filterIssueGroupIssues(groups, isOpen)
+		closed := filterIssueGroupIssues(groups, isClosed)
 
-	openSeries := barSeriesFromGroups("Open Issues", open)
-	closedSeries := barSeriesFromGroups("Closed Issues", closed)
+		openSeries := barSeriesFromGroups(group.seriesName("Open Issues"), open, users)
+		closedSeries := barSeriesFromGroups(group.seriesName("Closed Issues"), closed, users)
+		data = append(data, openSeries, closedSeries)
+	}
 
-	createBarChart(
-		"Number of issues opened per user",
+	return createBarChart(
+		graphTitle("Number of issues opened per user"),
 		"Username",
 		"Number of issues opened",
 		graphFileName,
-		openSeries,
-		closedSeries)
+		data...)
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGraphsWithNoData(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	saved := parsed
+	defer func() { parsed = saved }()
+	parsed.repositories = []repository{{"owner", "a"}, {"owner", "b"}}
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		graph func(fileName string) error
+	}{
+		{"bugs", func(fileName string) error { return graphBugFixRate(nil, "hol430", fileName) }},
+		{"openIssues", func(fileName string) error { return graphIssuesByDate(nil, fileName) }},
+		{"openPullRequests", func(fileName string) error { return graphPullRequestsByDate(nil, fileName) }},
+		{"openedVsClosed", func(fileName string) error { return graphOpenedVsClosed(nil, fileName) }},
+		{"closedByUser", func(fileName string) error { return graphOpenedVsClosedForUser(nil, nil, "hol430", fileName) }},
+		{"fixersComparison", func(fileName string) error { return graphOpenedVsClosedForUsers(nil, nil, fileName, "hol430") }},
+		{"fixersComparisonByBugCount", func(fileName string) error { return graphBugfixRateByUser(nil, nil, fileName, 5) }},
+		{"issuesOpenedByUser", func(fileName string) error { return graphIssuesOpenedByUser(nil, 5, fileName) }},
+	}
+	for _, perRepo := range []bool{false, true} {
+		settings.PerRepo = perRepo
+		for _, test := range tests {
+			if err := test.graph(filepath.Join(dir, test.name+".png")); err != nil {
+				t.Errorf("%s (per-repo %v): %v", test.name, perRepo, err)
+			}
+		}
+	}
+}
@@ -15,16 +15,17 @@ type intSeries struct {
 }
 
 // getXYPairs returns the graph's XY data as a plotter.XYs object.
-func (s intSeries) getXYPairs() plotter.XYs {
+// Returns an error if the x and y data have different lengths.
+func (s intSeries) getXYPairs() (plotter.XYs, error) {
 	if len(s.X) != len(s.Y) {
-		panic(fmt.Sprintf("Error in series '%s': x/y data length mismatch", s.Name))
+		return nil, fmt.Errorf("error in series '%s': x/y data length mismatch", s.Name)
 	}
 	points := make(plotter.XYs, len(s.X))
 	for i, x := range s.X {
 		points[i].X = float64(x)
 		points[i].Y = float64(s.Y[i])
 	}
-	return points
+	return points, nil
 }
 
 // getName returns the series' name to be used in the legend.
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sources of issue links.
+const (
+	// linkFromClosedEvent is the source of a link derived from the event
+	// in an issue's timeline which records that the issue was closed by
+	// a pull request.
+	linkFromClosedEvent = "closed_event"
+	// linkFromClosingReference is the source of a link derived from a
+	// pull request's closing issue references (i.e. the issues which are
+	// closed when the pull request is merged).
+	linkFromClosingReference = "closing_reference"
+)
+
+// issueLink records that an issue was fixed by a pull request, as
+// reported by github.
+type issueLink struct {
+	// IssueRepo is the full name (owner/repo) of the issue's repository.
+	IssueRepo string `json:"issue_repo"`
+	Issue     int    `json:"issue"`
+	// PullRepo is the full name of the pull request's repository.
+	PullRepo string `json:"pull_repo"`
+	Pull     int    `json:"pull"`
+	// Source is where the link came from (linkFromClosedEvent or
+	// linkFromClosingReference).
+	Source string `json:"source"`
+}
+
+// issueRef refers to an issue in a repository.
+type issueRef struct {
+	// Repo is the full name (owner/repo) of the issue's repository.
+	Repo   string
+	Number int
+}
+
+// linkIndex maps the full reference of a pull request (see pullKey) to
+// the issues which it fixed.
+type linkIndex map[string][]issueRef
+
+// newLinkIndex creates an index of the issues fixed by each pull request
+// from a list of links.
+func newLinkIndex(links []issueLink) linkIndex {
+	index := make(linkIndex)
+	for _, link := range links {
+		key := pullKey(link.PullRepo, link.Pull)
+		ref := issueRef{Repo: link.IssueRepo, Number: link.Issue}
+		if indexOfRef(index[key], ref) < 0 {
+			index[key] = append(index[key], ref)
+		}
+	}
+	return index
+}
+
+// pullKey returns the full reference of a pull request (owner/repo#N),
+// in lower case, as github treats owner and repository names as case
+// insensitive. It may also be used for issues.
+func pullKey(repo string, number int) string {
+	return strings.ToLower(fmt.Sprintf("%s#%d", repo, number))
+}
+
+// indexOfRef searches a slice for an issue reference and returns its
+// index, or -1 if not found.
+func indexOfRef(refs []issueRef, ref issueRef) int {
+	for i, r := range refs {
+		if r == ref {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// labelFilter is a boolean expression over the labels of an issue, such
+// as `(sugarcane OR wheat) AND bug AND NOT wontfix`.
+type labelFilter interface {
+	// matches checks if an issue's labels satisfy the expression.
+	matches(issue octokit.Issue) bool
+}
+
+// labelTerm matches issues with a label. The label may be a glob, in
+// which * matches any run of characters and ? matches one character.
+type labelTerm struct {
+	label   string
+	pattern *regexp.Regexp
+}
+
+func (t labelTerm) matches(issue octokit.Issue) bool {
+	if hasLabel(issue, t.label) {
+		return true
+	}
+	for _, lbl := range issue.Labels {
+		if t.pattern.MatchString(lbl.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelAnd matches issues which match both operands.
+type labelAnd struct{ left, right labelFilter }
+
+func (e labelAnd) matches(issue octokit.Issue) bool {
+	return e.left.matches(issue) && e.right.matches(issue)
+}
+
+// labelOr matches issues which match either operand.
+type labelOr struct{ left, right labelFilter }
+
+func (e labelOr) matches(issue octokit.Issue) bool {
+	return e.left.matches(issue) || e.right.matches(issue)
+}
+
+// labelNot matches issues which don't match its operand.
+type labelNot struct{ operand labelFilter }
+
+func (e labelNot) matches(issue octokit.Issue) bool {
+	return !e.operand.matches(issue)
+}
+
+// newLabelTerm creates a term matching a label or label glob.
+func newLabelTerm(label string) labelTerm {
+	pattern := regexp.QuoteMeta(label)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	return labelTerm{label, regexp.MustCompile("^" + pattern + "$")}
+}
+
+// labelTokenRx matches a token of a label filter: a parenthesis, a
+// double-quoted label (which may contain spaces or parentheses), or a
+// word.
+var labelTokenRx = regexp.MustCompile(`^\s*(\(|\)|"[^"]*"|[^\s()"]+)`)
+
+// parseLabelFilter parses a label filter. Labels are combined with AND,
+// OR and NOT (in decreasing order of precedence: NOT, AND, OR), and
+// grouped with parentheses. Labels containing spaces or parentheses, or
+// which are the same as an operator, must be double-quoted. A filter
+// consisting of a single label matches issues with that label.
+func parseLabelFilter(expr string) (labelFilter, error) {
+	var tokens []string
+	for rest := expr; strings.TrimSpace(rest) != ""; {
+		match := labelTokenRx.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("invalid label filter '%s': unterminated quote", expr)
+		}
+		tokens = append(tokens, match[1])
+		rest = rest[len(match[0]):]
+	}
+	p := labelParser{tokens: tokens}
+	filter, err := p.parseOr()
+	if err == nil && p.pos < len(tokens) {
+		err = fmt.Errorf("unexpected '%s'", tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid label filter '%s': %w", expr, err)
+	}
+	return filter, nil
+}
+
+// labelParser is a recursive descent parser for label filters.
+type labelParser struct {
+	tokens []string
+	pos    int
+}
+
+// next returns the next token, or "" at the end of the filter.
+func (p *labelParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// accept consumes the next token if it is the given operator (which is
+// case-insensitive).
+func (p *labelParser) accept(operator string) bool {
+	if strings.EqualFold(p.next(), operator) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *labelParser) parseOr() (labelFilter, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("OR") {
+		var right labelFilter
+		right, err = p.parseAnd()
+		left = labelOr{left, right}
+	}
+	return left, err
+}
+
+func (p *labelParser) parseAnd() (labelFilter, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("AND") {
+		var right labelFilter
+		right, err = p.parseNot()
+		left = labelAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *labelParser) parseNot() (labelFilter, error) {
+	if p.accept("NOT") {
+		operand, err := p.parseNot()
+		return labelNot{operand}, err
+	}
+	return p.parseTerm()
+}
+
+func (p *labelParser) parseTerm() (labelFilter, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("expected a label")
+	case p.accept("("):
+		filter, err := p.parseOr()
+		if err == nil && !p.accept(")") {
+			err = fmt.Errorf("missing ')'")
+		}
+		return filter, err
+	case token == ")" || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR"):
+		return nil, fmt.Errorf("expected a label but found '%s'", token)
+	}
+	p.pos++
+	return newLabelTerm(strings.Trim(token, `"`)), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// labeledIssue returns an issue with the given labels.
+func labeledIssue(labels ...string) octokit.Issue {
+	var issue octokit.Issue
+	for _, label := range labels {
+		issue.Labels = append(issue.Labels, struct {
+			URL   string `json:"url,omitempty"`
+			Name  string `json:"name,omitempty"`
+			Color string `json:"color,omitempty"`
+		}{Name: label})
+	}
+	return issue
+}
+
+func TestParseLabelFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		// Labels of issues which match, and of issues which don't.
+		matches, nonMatches [][]string
+	}{
+		{"bug", [][]string{{"bug"}, {"wontfix", "bug"}}, [][]string{{}, {"Bug"}, {"bugs"}}},
+		{"bug AND NOT wontfix", [][]string{{"bug"}, {"bug", "sugarcane"}}, [][]string{{"bug", "wontfix"}, {"wontfix"}, {}}},
+		{"bug and not wontfix", [][]string{{"bug"}}, [][]string{{"bug", "wontfix"}}},
+		{"(sugarcane OR wheat) AND bug", [][]string{{"sugarcane", "bug"}, {"wheat", "bug"}}, [][]string{{"sugarcane"}, {"bug"}, {"wheat", "sugarcane"}}},
+		{"sugarcane OR wheat AND bug", [][]string{{"sugarcane"}, {"wheat", "bug"}}, [][]string{{"wheat"}, {"bug"}}},
+		{"NOT bug OR wontfix", [][]string{{}, {"bug", "wontfix"}}, [][]string{{"bug"}}},
+		{"NOT NOT bug", [][]string{{"bug"}}, [][]string{{}}},
+		{"NOT (bug OR wontfix)", [][]string{{"docs"}}, [][]string{{"bug"}, {"wontfix"}}},
+		{"sugar*", [][]string{{"sugar"}, {"sugarcane"}}, [][]string{{"Sugarcane"}, {"cane"}}},
+		{"v?", [][]string{{"v1"}, {"v2"}}, [][]string{{"v"}, {"v10"}}},
+		{"a.b", [][]string{{"a.b"}}, [][]string{{"axb"}}},
+		{`"good first issue" AND NOT "AND"`, [][]string{{"good first issue"}}, [][]string{{"good first issue", "AND"}, {"good"}}},
+		{`"plant (crop)"`, [][]string{{"plant (crop)"}}, [][]string{{"plant"}}},
+		{"  ( bug )  ", [][]string{{"bug"}}, [][]string{{}}},
+	}
+	for _, test := range tests {
+		filter, err := parseLabelFilter(test.expr)
+		if err != nil {
+			t.Errorf("parseLabelFilter(%q): %v", test.expr, err)
+			continue
+		}
+		for _, labels := range test.matches {
+			if !filter.matches(labeledIssue(labels...)) {
+				t.Errorf("%q doesn't match an issue labelled %v", test.expr, labels)
+			}
+		}
+		for _, labels := range test.nonMatches {
+			if filter.matches(labeledIssue(labels...)) {
+				t.Errorf("%q matches an issue labelled %v", test.expr, labels)
+			}
+		}
+	}
+}
+
+func TestParseLabelFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		// want is a part of the expected error message.
+		want string
+	}{
+		{"", "expected a label"},
+		{"   ", "expected a label"},
+		{`"bug`, "unterminated quote"},
+		{`bug AND "won't fix`, "unterminated quote"},
+		{"bug AND", "expected a label"},
+		{"bug OR", "expected a label"},
+		{"NOT", "expected a label"},
+		{"AND bug", "expected a label but found 'AND'"},
+		{"bug OR or wontfix", "expected a label but found 'or'"},
+		{"(bug", "missing ')'"},
+		{"(bug OR wontfix", "missing ')'"},
+		{"bug)", "unexpected ')'"},
+		{")", "expected a label but found ')'"},
+		{"()", "expected a label but found ')'"},
+		{"bug wontfix", "unexpected 'wontfix'"},
+	}
+	for _, test := range tests {
+		_, err := parseLabelFilter(test.expr)
+		if err == nil {
+			t.Errorf("parseLabelFilter(%q): expected an error", test.expr)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseLabelFilter(%q): got error %q, want %q", test.expr, err, test.want)
+		}
+	}
+}
@@ -1,78 +1,224 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/octokit/go-octokit/octokit"
 )
 
 const (
-	owner       = "APSIMInitiative"
-	repo        = "ApsimX"
-	issuesCache = ".issues.cache"
-	pullsCache  = ".pulls.cache"
+	issuesCache   = "issues.cache"
+	pullsCache    = "pulls.cache"
+	linksCache    = "links.cache"
+	metadataCache = "metadata.cache"
+
+	issuesCheckpoint = "issues.checkpoint"
+	pullsCheckpoint  = "pulls.checkpoint"
 )
 
 var (
 	settings options
+	// parsed holds the parsed values of the options in settings. It is
+	// set when the options are validated, before any command is run.
+	parsed parsedOptions
 )
 
 func main() {
-	args, err := flags.Parse(&settings)
+	err := run()
 	if err != nil {
-		if flags.WroteHelp(err) {
-			return
+		code := exitCode(err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if code == exitNetworkFailure {
+			fmt.Fprintln(os.Stderr, "Rerun to resume fetching from where this run stopped.")
 		}
-		panic(err)
+		os.Exit(code)
+	}
+}
+
+// run parses the command line arguments and runs the command given by
+// the user. If no command is given, the data is fetched, and the report
+// and all graphs are generated. Any error which occurs is returned with
+// an exit code attached (see exitCode).
+func run() error {
+	// Errors are printed by main, so go-flags shouldn't print them.
+	parser := flags.NewParser(&settings, flags.HelpFlag|flags.PassDoubleDash)
+	parser.SubcommandsOptional = true
+
+	// Settings in the config file are the defaults for the command line
+	// options.
+	configFile, required := configFileName(os.Args[1:])
+	if err := loadConfig(parser, configFile, required); err != nil {
+		return withExitCode(exitBadArguments, err)
+	}
+
+	parser.CommandHandler = func(command flags.Commander, args []string) error {
+		var err error
+		if parsed, err = settings.validate(time.Now()); err != nil {
+			return withExitCode(exitBadArguments, err)
+		}
+		if settings.GraphOptions.ListGraphs {
+			listGraphs()
+			return nil
+		}
+		for _, repo := range parsed.repositories {
+			if err := migrateLegacyCache(repo); err != nil {
+				return err
+			}
+		}
+		if command == nil {
+			return runAll(args)
+		}
+		return command.Execute(args)
+	}
+	_, err := parser.Parse()
+	if flags.WroteHelp(err) {
+		fmt.Println(err)
+		return nil
+	}
+	var flagsErr *flags.Error
+	if errors.As(err, &flagsErr) {
+		return withExitCode(exitBadArguments, err)
 	}
+	return err
+}
+
+// runAll fetches the data, then prints the report and generates the
+// graphs selected by the user. In dry run mode, it stops after fetching
+// the data.
+func runAll(args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	graphs, err := selectedGraphs(nil)
+	if err != nil {
+		return withExitCode(exitBadArguments, err)
+	}
+	issues, pullRequests, err := loadData(parsed)
+	if err != nil {
+		return err
+	}
+	if settings.DryRun {
+		return nil
+	}
+	printReport(issues, pullRequests, parsed)
+	return drawGraphs(issues, pullRequests, graphs, parsed)
+}
+
+// noArguments returns an error if there are any leftover unrecognised
+// arguments.
+func noArguments(args []string) error {
 	if len(args) > 0 {
-		// If there are any leftover unrecognised arguments, throw a fatal
-		panic(fmt.Sprintf("Error: unrecognised arguments: %v", args))
+		return withExitCode(exitBadArguments, fmt.Errorf("unrecognised arguments: %v", args))
 	}
+	return nil
+}
 
-	auth := getAuth("credentials.dat")
-	client := octokit.NewClient(auth)
-	issues, pullRequests := getData(client)
+// getAllData gets the issues and pull requests for all repositories,
+// and indexes the links between them in closingReferences. Data is read
+// from the cache or fetched from github, as described by getData.
+func getAllData(opts parsedOptions) ([]octokit.Issue, []octokit.PullRequest, error) {
+	// The database is opened first, as it is a source of cached data.
+	if settings.Database != "" {
+		db, err := openStore(settings.Database)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer db.Close()
+		database = db
+	}
+	// No credentials are needed if all data is read from the cache, or
+	// from snapshots.
+	var f fetcher
+	if opts.asOf.IsZero() && (!settings.UseCache || !allCached(opts.repositories)) {
+		auth, err := findAuth()
+		if err != nil {
+			return nil, nil, err
+		}
+		f = newFetcher(auth)
+	}
+	issues, pullRequests, links, err := getData(f, opts.repositories, opts.asOf)
+	if err != nil {
+		return nil, nil, err
+	}
+	closingReferences = newLinkIndex(links)
+	return issues, pullRequests, nil
+}
 
-	if settings.LabelFilter != "" {
+// loadData gets the issues and pull requests for all repositories (see
+// getAllData), filtered on the label filter and query given by the user.
+func loadData(opts parsedOptions) ([]octokit.Issue, []octokit.PullRequest, error) {
+	issues, pullRequests, err := getAllData(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.labelFilter != nil {
+		if !settings.Quiet {
+			fmt.Printf("Filtering on issues with labels matching %s...\n", settings.LabelFilter)
+		}
+		issues = issuesWithLabel(issues, opts.labelFilter)
+		pullRequests = pullsWithLabel(pullRequests, issues, opts.labelFilter)
+	}
+	if len(opts.query) > 0 {
 		if !settings.Quiet {
-			fmt.Printf("Filtering on issues with the %s label...\n", settings.LabelFilter)
+			fmt.Printf("Filtering on issues and pull requests matching %s...\n", settings.Where)
 		}
-		issues = issuesWithLabel(issues, settings.LabelFilter)
-		pullRequests = pullsWithLabel(pullRequests, issues, settings.LabelFilter)
+		issues = filterIssues(issues, opts.query.matchesIssue)
+		pullRequests = filterPullRequests(pullRequests, opts.query.matchesPull)
 	}
+	return issues, pullRequests, nil
+}
+
+// printReport prints statistics about the issues and pull requests
+// within the date window given by the user, as they were at the end of
+// the window. Each statistic states which issues and pull requests it
+// counts (see reportMetrics).
+func printReport(issues []octokit.Issue, pullRequests []octokit.PullRequest, opts parsedOptions) {
+	window, semantics := opts.window, opts.semantics
 
 	// Diagnostics
 	if !settings.Quiet {
-		fmt.Printf("Owner:                                  %s\n", owner)
-		fmt.Printf("Repo:                                   %s\n", repo)
-		fmt.Printf("User:                                   %s\n\n", settings.Username)
-	}
-
-	fmt.Printf("Number of open issues:                      %d\n", getNumOpenIssues(issues))
-	fmt.Printf("Number of closed issues:                    %d\n", getNumClosedIssues(issues))
-	fmt.Printf("Number of open pull requests:               %d\n", getNumOpenPullRequests(pullRequests))
-	fmt.Printf("Number of closed pull requests:             %d\n", getNumClosedPullRequests(pullRequests))
-	fmt.Printf("Number of issues opened by %s:              %d\n", settings.Username, getNumIssuesOpenedBy(issues, settings.Username))
-
-	since := settings.Since()
-	issues = filterIssues(issues, func(issue octokit.Issue) bool {
-		return issue.CreatedAt.After(since)
-	})
-	pullRequests = filterPullRequests(pullRequests, func(pull octokit.PullRequest) bool {
-		return pull.MergedAt != nil && pull.MergedAt.After(since)
-	})
-	fmt.Printf("Number of bugs closed since %s:             %d\n", since.Format("2/1/2006"), bugsFixedSince(issues, since))
-	fmt.Printf("Number of issues closed since %s:           %d\n\n", since.Format("2/1/2006"), issuesFixedSince(issues, since))
-
-	// Graphs
-	graphBugFixRate(pullRequests, settings.Username, "bugs.png")
-	graphIssuesByDate(issues, "openIssues.png")
-	graphOpenedVsClosed(issues, "openedVsClosed.png")
-    graphOpenedVsClosedForUser(issues, pullRequests, settings.Username, "closedByUser.png")
-	graphOpenedVsClosedForUsers(issues, pullRequests, "fixersComparison.png", settings.Username, "zur003", "hol353")
-	graphBugfixRateByUser(issues, pullRequests, "fixersComparisonByBugCount.png", 100)
-	graphBugfixRateByUser(issues, pullRequests, "allfixersComparison.png", -1)
-	graphIssuesOpenedByUser(issues, 50, "issuesOpenedByUser.png")
+		fmt.Printf("Repositories:                           %s\n", opts.repositoryNames())
+		fmt.Printf("User:                                   %s\n", settings.Username)
+		fmt.Printf("Period:                                 %s\n\n", window)
+	}
+
+	for _, metric := range reportMetrics() {
+		var value int
+		if metric.issues != nil {
+			value = metric.issues(window.selectIssues(issues, semantics[metric.name]))
+		} else {
+			value = metric.pulls(window.selectPulls(pullRequests, semantics[metric.name]))
+		}
+		label := fmt.Sprintf("%s (%s in period):", metric.label, semantics[metric.name])
+		fmt.Printf("%-64s%d\n", label, value)
+	}
+	fmt.Println()
+}
+
+// drawGraphs draws a list of graphs, using the issues and pull requests
+// created within the date window given by the user (and the pull
+// requests merged within it), as they were at the end of the window.
+// The graphs are written to the output directory given by the user.
+func drawGraphs(issues []octokit.Issue, pullRequests []octokit.PullRequest, graphs []namedGraph, opts parsedOptions) error {
+	window := opts.window
+	data := graphData{
+		issues:      window.selectIssues(issues, windowCreated),
+		openedPulls: window.selectPulls(pullRequests, windowCreated),
+		mergedPulls: window.mergedPulls(pullRequests),
+	}
+	if err := os.MkdirAll(settings.OutputDir, 0755); err != nil {
+		return withExitCode(exitRenderFailure, err)
+	}
+	for _, graph := range graphs {
+		if err := graph.draw(data, filepath.Join(settings.OutputDir, graph.name+".png")); err != nil {
+			return err
+		}
+	}
+	return nil
 }
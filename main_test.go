@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// runWith runs the program with the given command line arguments,
+// starting from the default options.
+func runWith(t *testing.T, args ...string) error {
+	t.Helper()
+	saved := os.Args
+	defer func() { os.Args = saved }()
+	os.Args = append([]string{"apsimissues"}, args...)
+	settings = options{}
+	return run()
+}
+
+func TestRunExitCodes(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	if err := ioutil.WriteFile("invalid.yaml", []byte("colour: red\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"--help"}, exitSuccess},
+		{[]string{"--list-graphs"}, exitSuccess},
+		{[]string{"cache", "info"}, exitSuccess},
+		{[]string{"--no-such-option"}, exitBadArguments},
+		{[]string{"--workers", "many"}, exitBadArguments},
+		{[]string{"--since", "someday", "report"}, exitBadArguments},
+		{[]string{"--repository", "ApsimX", "report"}, exitBadArguments},
+		{[]string{"--graphs", "noSuchGraph", "graph"}, exitBadArguments},
+		{[]string{"report", "extra"}, exitBadArguments},
+		{[]string{"--config", "missing.yaml", "report"}, exitBadArguments},
+		{[]string{"--config", "invalid.yaml", "report"}, exitBadArguments},
+	}
+	for _, test := range tests {
+		if got := exitCode(runWith(t, test.args...)); got != test.want {
+			t.Errorf("%v: got exit code %d, want %d", test.args, got, test.want)
+		}
+	}
+}
@@ -1,23 +1,243 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
 
 // options provides a class to store command line arguments.
 type options struct {
-	Username    string `short:"u" default:"hol430" long:"username" description:"github username"`
-	Date        string `short:"s" long:"since" default:"1/1/1970" description:"Only show data after this date"`
-	Quiet       bool   `short:"q" long:"quiet" description:"Suppress progress reporting"`
-	UseCache    bool   `short:"c" long:"use-cache" description:"Use cache - do not fetch live data"`
-	DryRun      bool   `short:"d" long:"dry-run" description:"Update cache with live data and immediately exit"`
-	LabelFilter string `short:"l" long:"label" description:"Only process issues with a given label"`
+	Config      string   `long:"config" description:"Config file holding default values of these options (default: apsimissues.yaml, if it exists)"`
+	Username    string   `short:"u" default:"hol430" long:"username" description:"github username"`
+	Credentials string   `long:"credentials" description:"File containing github credentials (default: GITHUB_TOKEN or GH_TOKEN, or GH_ENTERPRISE_TOKEN for other API hosts, credentials.dat or ~/.netrc)"`
+	Owner       string   `short:"o" long:"owner" default:"APSIMInitiative" description:"Owner of the github repository"`
+	Repo        string   `short:"r" long:"repo" default:"ApsimX" description:"Name of the github repository"`
+	RepoList    []string `long:"repository" description:"Repository to report on, in the form owner/repo. May be given multiple times. Overrides --owner and --repo"`
+	PerRepo     bool     `long:"per-repo" description:"Graph one series per repository rather than aggregating across repositories"`
+	Date        string   `short:"s" long:"since" default:"1/1/1970" description:"Only show data from this date, e.g. 2025-07-01, 1/7/2025, 2025-Q3, 90d or last-quarter"`
+	UntilDate   string   `long:"until" description:"Only show data up to (and including) this date, in the same forms as --since (default: now)"`
+	Windows     []string `long:"window" description:"Which issues and pull requests a report metric counts: those created, closed or active (open at any time) in the period, as metric=semantics (e.g. open-issues=active), or just semantics for all metrics. May be given multiple times"`
+	AsOf        string   `long:"as-of" description:"Use the latest snapshot of the data taken on or before this date, in the same forms as --since, rather than the cache"`
+	NoSnapshot  bool     `long:"no-snapshot" description:"Do not store fetched data as a snapshot"`
+	KeepSnaps   int      `long:"keep-snapshots" description:"Number of snapshots of each repository to keep when a snapshot is stored; older snapshots are deleted (default: all)"`
+	Quiet       bool     `short:"q" long:"quiet" description:"Suppress progress reporting"`
+	UseCache    bool     `short:"c" long:"use-cache" description:"Use cache - do not fetch live data"`
+	Incremental bool     `short:"i" long:"incremental" description:"Only fetch data which has changed since the cache was last updated"`
+	Compress    bool     `long:"compress" description:"Compress cache files with gzip. Compressed cache files are always detected when read"`
+	StripFields bool     `long:"strip-fields" description:"Only store the fields of issues and pull requests which are used by this program in cache files"`
+	Workers     int      `short:"w" long:"workers" default:"4" description:"Maximum number of pages to fetch concurrently"`
+	MaxRetries  int      `long:"max-retries" default:"5" description:"Number of times to retry a request which fails due to rate limiting or a transient error"`
+	NoPageCache bool     `long:"no-page-cache" description:"Do not use conditional requests to avoid re-downloading unchanged pages"`
+	APIURL      string   `long:"api-url" default:"https://api.github.com" description:"Base URL of the github API, e.g. https://github.example.com/api/v3 for GitHub Enterprise"`
+	Backend     string   `long:"backend" default:"rest" choice:"rest" choice:"graphql" description:"Github API used to fetch data"`
+	DryRun      bool     `short:"d" long:"dry-run" description:"Update cache with live data and immediately exit"`
+	LabelFilter string   `short:"l" long:"label" description:"Only process issues whose labels match a filter, e.g. bug, 'bug AND NOT wontfix' or '(sugar* OR wheat) AND bug'"`
+	Where       string   `long:"where" description:"Only process issues and pull requests matching a query, e.g. 'author:hol430 state:closed closed:>2024-01-01 title~Soil'"`
+	Bots        []string `long:"bot" description:"Bot account, which is excluded from per-user graphs. May be given multiple times. Accounts ending in [bot] are always treated as bots"`
+	Database    string   `long:"database" description:"SQLite database to which fetched data is also written, and from which cached data is read"`
+	OutputDir   string   `long:"output-dir" default:"." description:"Directory to which graphs are written"`
+
+	// labelAliases maps a label to the labels which are treated as
+	// equivalent to it (e.g. bug to defect and "type: bug"). It can only
+	// be set via the config file.
+	labelAliases map[string][]string
+
+	GraphOptions graphOptions `group:"Graph Options"`
+
+	// Commands. If no command is given, the data is fetched, and the
+	// report and all graphs are generated.
+	Fetch    fetchCommand    `command:"fetch" description:"Fetch data from github and update the cache"`
+	Report   reportCommand   `command:"report" description:"Print statistics (using cached data if available)"`
+	Graph    graphCommand    `command:"graph" description:"Generate graphs (using cached data if available)"`
+	Cache    cacheCommand    `command:"cache" description:"Inspect or manage the cache"`
+	Snapshot snapshotCommand `command:"snapshot" description:"List or compare snapshots of the data"`
+}
+
+// graphOptions provides a class to store the command line arguments
+// which select and control graphs.
+type graphOptions struct {
+	Graphs          string `long:"graphs" description:"Comma-separated list of graphs to generate (default: all)"`
+	ListGraphs      bool   `long:"list-graphs" description:"List the available graphs and exit"`
+	MinBugsFixed    int    `long:"min-bugs-fixed" default:"100" description:"Minimum number of bugs fixed by a user to be shown on the fixersComparisonByBugCount graph"`
+	MinIssuesOpened int    `long:"min-issues-opened" default:"50" description:"Users who have opened this many issues or fewer are not shown on the issuesOpenedByUser graph"`
+
+	CompareUsers []string `long:"compare-user" description:"User to show on the fixersComparison graph. May be given multiple times (default: --username, zur003 and hol353)"`
+	TeamFile     string   `long:"team-file" description:"File listing users to show on the fixersComparison graph, one per line"`
+}
+
+// defaultCompareUsers are the users shown on the fixersComparison graph
+// (after the user given by --username) if no users are given.
+var defaultCompareUsers = []string{"zur003", "hol353"}
+
+// compareUsers returns the users to show on the fixersComparison graph:
+// those given by --compare-user followed by those in the team file,
+// without duplicates. Defaults to the user given by --username and
+// defaultCompareUsers if neither option is given.
+func (o options) compareUsers() ([]string, error) {
+	g := o.GraphOptions
+	if len(g.CompareUsers) == 0 && g.TeamFile == "" {
+		return append([]string{o.Username}, defaultCompareUsers...), nil
+	}
+	users := g.CompareUsers
+	if g.TeamFile != "" {
+		team, err := readTeamFile(g.TeamFile)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, team...)
+	}
+	var result []string
+	for _, user := range users {
+		if indexOfString(result, user) < 0 {
+			result = append(result, user)
+		}
+	}
+	return result, nil
 }
 
 // sinceDate returns the 'since' option passed by the user. Defaults to
-// 1/1/1970. Panics if provided option is not a valid Time.
-func (o options) Since() time.Time {
-	t, err := time.Parse("2/1/2006", o.Date)
+// 1/1/1970. If the option refers to a range of dates (e.g. 2025-Q3), the
+// start of the range is returned. Returns an error if provided option is
+// not a valid date (see parseDateRange). Relative dates are relative to
+// now.
+func (o options) Since(now time.Time) (time.Time, error) {
+	start, _, err := parseDateRange(o.Date, now)
+	return start, err
+}
+
+// Until returns the (exclusive) end of the 'until' option passed by the
+// user. If the option refers to a range of dates (e.g. a day), the end
+// of the range is returned. Returns the zero time if the option is not
+// given.
+func (o options) Until(now time.Time) (time.Time, error) {
+	if o.UntilDate == "" {
+		return time.Time{}, nil
+	}
+	_, end, err := parseDateRange(o.UntilDate, now)
+	return end, err
+}
+
+// window returns the range of dates given by the --since and --until
+// options.
+func (o options) window(now time.Time) (dateWindow, error) {
+	since, err := o.Since(now)
 	if err != nil {
-		panic(err)
+		return dateWindow{}, err
+	}
+	until, err := o.Until(now)
+	if err != nil {
+		return dateWindow{}, err
+	}
+	if !until.IsZero() && !since.Before(until) {
+		return dateWindow{}, fmt.Errorf("--since (%s) must be before --until (%s)", o.Date, o.UntilDate)
+	}
+	return dateWindow{since: since, until: until}, nil
+}
+
+// Repositories returns the repositories passed by the user via the
+// --repository option. Defaults to the single repository given by the
+// --owner and --repo options. Returns an error if a repository is not of
+// the form owner/repo.
+func (o options) Repositories() ([]repository, error) {
+	if len(o.RepoList) == 0 {
+		return []repository{{Owner: o.Owner, Name: o.Repo}}, nil
+	}
+	var repos []repository
+	for _, name := range o.RepoList {
+		repo, err := parseRepository(name)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// apiURL returns the base URL of the github API passed by the user,
+// without a trailing slash.
+func (o options) apiURL() string {
+	return strings.TrimSuffix(o.APIURL, "/")
+}
+
+// parsedOptions holds the values of the options which have to be parsed.
+// These are parsed once, by validate, so that relative dates (e.g. 90d)
+// refer to the same time wherever they are used.
+type parsedOptions struct {
+	// window is the range of dates given by --since and --until.
+	window dateWindow
+	// repositories are the repositories being reported on.
+	repositories []repository
+	// labelFilter is the filter given by --label, or nil if none is given.
+	labelFilter labelFilter
+	// query is the query given by --where.
+	query query
+	// semantics are the window semantics of each report metric, keyed by
+	// metric name.
+	semantics map[string]string
+	// asOf is the time before which the snapshot used by --as-of must
+	// have been taken (see snapshotDeadline), or the zero time if the
+	// option is not given.
+	asOf time.Time
+	// compareUsers are the users shown on the fixersComparison graph.
+	compareUsers []string
+}
+
+// validate checks that all options passed by the user are valid, and
+// returns their parsed values. Relative dates are relative to now.
+func (o options) validate(now time.Time) (parsedOptions, error) {
+	var p parsedOptions
+	var err error
+	if p.window, err = o.window(now); err != nil {
+		return p, err
+	}
+	if o.AsOf != "" {
+		if p.asOf, err = snapshotDeadline(o.AsOf, now); err != nil {
+			return p, err
+		}
+	}
+	if o.Workers < 1 {
+		return p, fmt.Errorf("invalid number of workers (%d)", o.Workers)
+	}
+	if o.MaxRetries < 0 {
+		return p, fmt.Errorf("invalid number of retries (%d)", o.MaxRetries)
+	}
+	if o.KeepSnaps < 0 {
+		return p, fmt.Errorf("invalid number of snapshots to keep (%d)", o.KeepSnaps)
+	}
+	if u, err := url.Parse(o.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return p, fmt.Errorf("invalid API URL '%s'", o.APIURL)
+	}
+	if p.repositories, err = o.Repositories(); err != nil {
+		return p, err
+	}
+	if o.LabelFilter != "" {
+		if p.labelFilter, err = parseLabelFilter(o.LabelFilter); err != nil {
+			return p, err
+		}
+	}
+	if p.query, err = parseQuery(o.Where, now); err != nil {
+		return p, err
+	}
+	if p.semantics, err = o.metricSemantics(); err != nil {
+		return p, err
+	}
+	if _, err := selectedGraphs(nil); err != nil {
+		return p, err
+	}
+	if p.compareUsers, err = o.compareUsers(); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// repositoryNames returns the full names of all repositories being
+// reported on, separated by commas.
+func (p parsedOptions) repositoryNames() string {
+	var names []string
+	for _, repo := range p.repositories {
+		names = append(names, repo.String())
 	}
-	return t
+	return strings.Join(names, ", ")
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestValidateOptions(t *testing.T) {
+	valid := func() options {
+		return options{Owner: "owner", Repo: "repo", Date: "1/1/1970", APIURL: githubAPIURL, Workers: 4, MaxRetries: 5}
+	}
+	if _, err := valid().validate(testNow); err != nil {
+		t.Fatalf("valid options are invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(o *options)
+		// want is a part of the expected error message.
+		want string
+	}{
+		{"no workers", func(o *options) { o.Workers = 0 }, "invalid number of workers (0)"},
+		{"negative workers", func(o *options) { o.Workers = -1 }, "invalid number of workers (-1)"},
+		{"negative retries", func(o *options) { o.MaxRetries = -1 }, "invalid number of retries (-1)"},
+		{"negative snapshots", func(o *options) { o.KeepSnaps = -1 }, "invalid number of snapshots to keep (-1)"},
+		{"API URL", func(o *options) { o.APIURL = "github.example.com" }, "invalid API URL"},
+		{"repository", func(o *options) { o.RepoList = []string{"ApsimX"} }, "ApsimX"},
+	}
+	for _, test := range tests {
+		o := valid()
+		test.change(&o)
+		_, err := o.validate(testNow)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+
+	// No retries is fine.
+	o := valid()
+	o.MaxRetries = 0
+	if _, err := o.validate(testNow); err != nil {
+		t.Errorf("--max-retries 0: %v", err)
+	}
+}
+
+func TestCompareUsers(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	if err := ioutil.WriteFile("team.txt", []byte("# The team\nalice\n\n  bob  \nhol430\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		compareUsers []string
+		teamFile     string
+		want         string
+	}{
+		{nil, "", "[hol430 zur003 hol353]"},
+		{[]string{"carol"}, "", "[carol]"},
+		{nil, "team.txt", "[alice bob hol430]"},
+		{[]string{"hol430", "carol"}, "team.txt", "[hol430 carol alice bob]"},
+	}
+	for _, test := range tests {
+		o := options{Username: "hol430"}
+		o.GraphOptions.CompareUsers = test.compareUsers
+		o.GraphOptions.TeamFile = test.teamFile
+		got, err := o.compareUsers()
+		if err != nil {
+			t.Errorf("--compare-user %v --team-file %q: %v", test.compareUsers, test.teamFile, err)
+		} else if fmt.Sprint(got) != test.want {
+			t.Errorf("--compare-user %v --team-file %q: got %v, want %s", test.compareUsers, test.teamFile, got, test.want)
+		}
+	}
+
+	o := options{}
+	o.GraphOptions.TeamFile = "missing.txt"
+	if _, err := o.compareUsers(); err == nil {
+		t.Error("missing team file: expected an error")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// pageCacheEntry is a cached response to a GET request, along with the
+// validators required to make a conditional request for it.
+type pageCacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// conditionalTransport is a http.RoundTripper which caches the response
+// to each GET request in a directory. When a request is repeated, it is
+// sent with the If-None-Match/If-Modified-Since headers, and if github
+// responds with 304 Not Modified, the cached response is returned. Such
+// requests do not count towards github's rate limit.
+type conditionalTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+// RoundTrip sends a request, using the cached response if github reports
+// that it has not been modified.
+func (t *conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+
+	fileName := t.entryFileName(req)
+	entry, cached := readPageCacheEntry(fileName)
+	if cached {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if cached && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return entry.response(req), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// The page cache is only an optimisation, so a failure to update it
+	// is not an error.
+	writePageCacheEntry(fileName, pageCacheEntry{
+		URL:          req.URL.String(),
+		ETag:         etag,
+		LastModified: lastModified,
+		Header:       resp.Header,
+		Body:         body,
+	})
+	return resp, nil
+}
+
+// entryFileName returns the name of the file in which the response to a
+// request is cached. Responses are keyed by URL, media type and
+// credentials, so that a page fetched with one user's credentials (which
+// may include private data) is never returned to a request made with
+// another's.
+func (t *conditionalTransport) entryFileName(req *http.Request) string {
+	hash := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept") + "\n" + req.Header.Get("Authorization")))
+	return filepath.Join(t.dir, hex.EncodeToString(hash[:]))
+}
+
+// response creates a http response from a cached page.
+func (e pageCacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// readPageCacheEntry reads a cached page from a file. Returns false if
+// the file does not exist or cannot be read.
+func readPageCacheEntry(fileName string) (pageCacheEntry, bool) {
+	var entry pageCacheEntry
+	f, err := os.Open(fileName)
+	if err != nil {
+		return entry, false
+	}
+	defer f.Close()
+	if json.NewDecoder(f).Decode(&entry) != nil {
+		return entry, false
+	}
+	return entry, true
+}
+
+// writePageCacheEntry writes a cached page to a file.
+func writePageCacheEntry(fileName string, entry pageCacheEntry) error {
+	err := os.MkdirAll(filepath.Dir(fileName), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(entry)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPageCacheNotModified(t *testing.T) {
+	var notModified int
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		writeIssues(w, 2, 1)
+	})
+
+	for i := 0; i < 2; i++ {
+		issues, err := getAllIssues(client, "owner", "repo", time.Time{}, newFetchProgress(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := issueNumbers(issues); fmt.Sprint(got) != "[2 1]" {
+			t.Errorf("fetch %d: got issues %v, want [2 1]", i+1, got)
+		}
+		// Otherwise the second fetch would resume from the checkpoint
+		// rather than sending any requests.
+		if err := removeCheckpoint(cacheFileName("owner", "repo", issuesCheckpoint)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if notModified != 1 {
+		t.Errorf("got %d 304 responses, want 1", notModified)
+	}
+}
+
+func TestPageCacheKeyedByAuth(t *testing.T) {
+	transport := &conditionalTransport{dir: t.TempDir()}
+	request := func(auth string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, githubAPIURL+"/repos/owner/repo/issues", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return req
+	}
+	names := make(map[string]string)
+	for _, auth := range []string{"", "token alice", "token bob"} {
+		name := transport.entryFileName(request(auth))
+		if other, ok := names[name]; ok {
+			t.Errorf("requests with credentials %q and %q share a page cache entry", other, auth)
+		}
+		names[name] = auth
+	}
+	if transport.entryFileName(request("token alice")) != transport.entryFileName(request("token alice")) {
+		t.Error("requests with the same credentials don't share a page cache entry")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// pageFetcher fetches the page of results at a given URL. It returns the
+// page's items (in a checkpointPage), and the link to the last page of
+// results, if any.
+type pageFetcher func(url string) (checkpointPage, *octokit.Hyperlink, error)
+
+// fetchAllPages fetches all pages of a paginated list of results,
+// starting from the first page. Once the first page has been fetched,
+// the number of pages is known (from its link to the last page), and
+// the remaining pages are fetched concurrently, by up to settings.Workers
+// workers. The pages are returned in order.
+//
+// If a page is marked as done by fetchPage, no later pages are fetched,
+// and any which have already been fetched are discarded.
+//
+// Each page is written to a checkpoint file as it is fetched, and pages
+// already present in the checkpoint file are not fetched again.
+func fetchAllPages(firstURL string, fetchPage pageFetcher, checkpointFile string, since time.Time, kind string, progress *fetchProgress) ([]checkpointPage, error) {
+	apiURL := settings.apiURL()
+	pages := make(map[int]checkpointPage)
+	for _, page := range readCheckpoint(checkpointFile, since, apiURL) {
+		pages[page.Page] = page
+	}
+	if len(pages) > 0 {
+		progress.log("Resuming fetch of %s from checkpoint (%d pages already fetched)", kind, len(pages))
+	}
+
+	// mutex guards pages, stopAt, fetchErr and the checkpoint file.
+	var mutex sync.Mutex
+	// The number of the first page which is marked as done, or 0.
+	stopAt := 0
+	var fetchErr error
+	save := func(page checkpointPage) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		pages[page.Page] = page
+		if page.Done && (stopAt == 0 || page.Page < stopAt) {
+			stopAt = page.Page
+		}
+		progress.update(kind, len(pages), page.NumPages)
+		return cacheError(checkpointFile, appendCheckpoint(checkpointFile, page))
+	}
+
+	first, ok := pages[1]
+	if !ok {
+		fetchedAt := time.Now()
+		page, lastPage, err := fetchPage(firstURL)
+		if err != nil {
+			return nil, err
+		}
+		page.Since = since
+		page.APIURL = apiURL
+		page.FetchedAt = fetchedAt
+		page.Page = 1
+		page.NumPages = 1
+		if lastPage != nil {
+			page.LastPageURL = string(*lastPage)
+			page.NumPages = pageNumber(page.LastPageURL)
+		}
+		if err := save(page); err != nil {
+			return nil, err
+		}
+		first = page
+	}
+	for _, page := range pages {
+		if page.Done && (stopAt == 0 || page.Page < stopAt) {
+			stopAt = page.Page
+		}
+	}
+
+	// Fetch the remaining pages concurrently.
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < settings.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				fetchedAt := time.Now()
+				var page checkpointPage
+				link, err := pageURL(first.LastPageURL, n)
+				if err == nil {
+					page, _, err = fetchPage(link)
+				}
+				if err == nil {
+					page.Since = since
+					page.APIURL = apiURL
+					page.FetchedAt = fetchedAt
+					page.Page = n
+					page.NumPages = first.NumPages
+					err = save(page)
+				}
+				if err != nil {
+					mutex.Lock()
+					if fetchErr == nil {
+						fetchErr = err
+					}
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	for n := 2; n <= first.NumPages; n++ {
+		mutex.Lock()
+		_, fetched := pages[n]
+		stop := fetchErr != nil || (stopAt > 0 && stopAt < n)
+		mutex.Unlock()
+		if stop {
+			break
+		}
+		if !fetched {
+			jobs <- n
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+
+	var numbers []int
+	for n := range pages {
+		if stopAt == 0 || n <= stopAt {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	result := make([]checkpointPage, len(numbers))
+	for i, n := range numbers {
+		result[i] = pages[n]
+	}
+	return result, nil
+}
+
+// pageNumber returns the page number in a page URL (its page query
+// parameter). Returns 1 if the URL has no page number.
+func pageNumber(pageURL string) int {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return 1
+	}
+	n, err := strconv.Atoi(u.Query().Get("page"))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// pageURL returns the URL of a given page, by changing the page number
+// in the URL of another page of the same results.
+func pageURL(otherPageURL string, page int) (string, error) {
+	u, err := url.Parse(otherPageURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
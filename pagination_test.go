@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// testPages returns a pageFetcher for numPages pages of results, each of
+// which holds one issue numbered after the page. Later pages are
+// returned sooner, so that they are fetched out of order. Pages from
+// done onwards are marked as done. fetched records the pages fetched,
+// and the maximum number fetched concurrently.
+func testPages(numPages, done int, fetched *fetchedPages) pageFetcher {
+	return func(url string) (checkpointPage, *octokit.Hyperlink, error) {
+		n := pageNumber(url)
+		fetched.start(n)
+		defer fetched.finish()
+		time.Sleep(time.Duration(numPages-n) * time.Millisecond)
+		page := checkpointPage{Issues: []octokit.Issue{testIssue(n)}, Done: done > 0 && n >= done}
+		last := octokit.Hyperlink(fmt.Sprintf("https://api.github.com/repos/owner/repo/issues?page=%d", numPages))
+		return page, &last, nil
+	}
+}
+
+// fetchedPages records the pages fetched by a pageFetcher.
+type fetchedPages struct {
+	mutex         sync.Mutex
+	pages         map[int]bool
+	active        int
+	maxConcurrent int
+}
+
+func (f *fetchedPages) start(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.pages == nil {
+		f.pages = make(map[int]bool)
+	}
+	f.pages[n] = true
+	f.active++
+	if f.active > f.maxConcurrent {
+		f.maxConcurrent = f.active
+	}
+}
+
+func (f *fetchedPages) finish() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.active--
+}
+
+func TestFetchAllPages(t *testing.T) {
+	tests := []struct {
+		numPages, done, workers int
+		// want lists the issues on the pages returned, in order.
+		want string
+	}{
+		{1, 0, 4, "[1]"},
+		{8, 0, 1, "[1 2 3 4 5 6 7 8]"},
+		{8, 0, 3, "[1 2 3 4 5 6 7 8]"},
+		{20, 0, 4, "[1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20]"},
+		// Pages after the first one marked as done are discarded, even if
+		// they were fetched.
+		{8, 3, 3, "[1 2 3]"},
+		{8, 1, 3, "[1]"},
+		{8, 8, 2, "[1 2 3 4 5 6 7 8]"},
+	}
+	for _, test := range tests {
+		useTestSettings(t, githubAPIURL)
+		settings.Workers = test.workers
+		var fetched fetchedPages
+		checkpointFile := filepath.Join(t.TempDir(), "checkpoint")
+		pages, err := fetchAllPages("https://api.github.com/repos/owner/repo/issues?page=1", testPages(test.numPages, test.done, &fetched),
+			checkpointFile, time.Time{}, "issues", newFetchProgress(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, page := range pages {
+			got = append(got, issueNumbers(page.Issues)...)
+		}
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("%d pages, done at %d, %d workers: got issues %v, want %s", test.numPages, test.done, test.workers, got, test.want)
+		}
+		if fetched.maxConcurrent > test.workers {
+			t.Errorf("%d pages, %d workers: fetched %d pages concurrently", test.numPages, test.workers, fetched.maxConcurrent)
+		}
+		if test.done == 1 && len(fetched.pages) != 1 {
+			t.Errorf("fetched %d pages after the first page was marked as done", len(fetched.pages))
+		}
+	}
+}
+
+func TestFetchAllPagesError(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	var fetched fetchedPages
+	pages := testPages(8, 0, &fetched)
+	failing := func(url string) (checkpointPage, *octokit.Hyperlink, error) {
+		if pageNumber(url) == 5 {
+			return checkpointPage{}, nil, fmt.Errorf("page 5 is unavailable")
+		}
+		return pages(url)
+	}
+	_, err := fetchAllPages("https://api.github.com/repos/owner/repo/issues?page=1", failing,
+		filepath.Join(t.TempDir(), "checkpoint"), time.Time{}, "issues", newFetchProgress(false))
+	if err == nil || err.Error() != "page 5 is unavailable" {
+		t.Errorf("got error %v, want the error fetching page 5", err)
+	}
+}
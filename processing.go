@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"time"
 
 	"github.com/octokit/go-octokit/octokit"
@@ -43,7 +44,8 @@ func getNumOpenPullRequests(pulls []octokit.PullRequest) int {
 }
 
 // getNumClosedPullRequests takes an array of pull requests and returns
-// the number of pull requests which are open.
+// the number of pull requests which are closed (including those which
+// were merged).
 func getNumClosedPullRequests(pulls []octokit.PullRequest) int {
 	var sum int
 	for _, pull := range pulls {
@@ -54,6 +56,19 @@ func getNumClosedPullRequests(pulls []octokit.PullRequest) int {
 	return sum
 }
 
+// getNumPullRequestsInState takes an array of pull requests and returns
+// the number of pull requests in a given state (pullOpen, pullMerged or
+// pullClosed).
+func getNumPullRequestsInState(pulls []octokit.PullRequest, state string) int {
+	var sum int
+	for _, pull := range pulls {
+		if pullState(pull) == state {
+			sum++
+		}
+	}
+	return sum
+}
+
 func getNumIssuesOpenedBy(issues []octokit.Issue, user string) int {
 	var sum int
 	for _, issue := range issues {
@@ -109,7 +124,7 @@ func issuesFixedByStaleBot(issues []octokit.Issue) []octokit.Issue {
 		return i.ClosedAt != nil
 	})
 	return filterIssues(closedIssues, func(i octokit.Issue) bool {
-		return issueHasLabel(i, "stale")
+		return hasLabel(i, "stale")
 	})
 }
 
@@ -153,6 +168,24 @@ func getOpenIssuesByDate(issues []octokit.Issue) map[time.Time]int {
 	return issuesByDate
 }
 
+// getOpenPullRequestsByDate gets a map of dates to the number of open
+// pull requests on that date.
+func getOpenPullRequestsByDate(pulls []octokit.PullRequest) map[time.Time]int {
+	pullsByDate := make(map[time.Time]int)
+	// Initialise the map with value for each date set to 0.
+	for _, pull := range pulls {
+		pullsByDate[pull.CreatedAt] = 0
+	}
+
+	for _, pull := range pulls {
+		incrementAfterDate(&pullsByDate, pull.CreatedAt)
+		if pull.ClosedAt != nil {
+			decrementAfterDate(&pullsByDate, *pull.ClosedAt)
+		}
+	}
+	return pullsByDate
+}
+
 // Gets a map of dates to the number of issues opened on or before that
 // date.
 func getCumOpenIssuesByDate(issues []octokit.Issue) map[time.Time]int {
@@ -189,14 +222,14 @@ func getCumIssuesClosedByDate(issues []octokit.Issue) map[time.Time]int {
 }
 
 // isBug checks if an issue is a bug
-// todo - refactor
 func isBug(issue octokit.Issue) bool {
-	var labels []string
-	for _, label := range issue.Labels {
-		labels = append(labels, label.Name)
-	}
+	return hasLabel(issue, "bug")
+}
 
-	return indexOfString(labels, "bug") >= 0
+// isBot checks if a github account is a bot. Accounts given by the
+// --bot option, and github apps (whose names end in [bot]) are bots.
+func isBot(login string) bool {
+	return strings.HasSuffix(login, "[bot]") || indexOfString(settings.Bots, login) >= 0
 }
 
 // isOpen checks if an issue is open
@@ -209,48 +242,44 @@ func isClosed(issue octokit.Issue) bool {
 	return !isOpen(issue)
 }
 
-// hasLabel checks if an issue has a given label.
+// hasLabel checks if an issue has a given label, or any of the label's
+// aliases (see the label-aliases config setting).
 func hasLabel(issue octokit.Issue, label string) bool {
-	for _, label := range issue.Labels {
-		if label.Name == settings.LabelFilter {
-			return true
-		}
-	}
-	return false
-}
-
-// hasLabel checks if an issue has a given label.
-func issueHasLabel(issue octokit.Issue, label string) bool {
+	aliases := settings.labelAliases[label]
 	for _, lbl := range issue.Labels {
-		if lbl.Name == label {
+		if lbl.Name == label || indexOfString(aliases, lbl.Name) >= 0 {
 			return true
 		}
 	}
 	return false
 }
 
-// issuesWithLabel takes a list of issues and returns those issues with a given label.
-func issuesWithLabel(issues []octokit.Issue, label string) []octokit.Issue {
-	return filterIssues(issues, func(issue octokit.Issue) bool {
-		return hasLabel(issue, label)
-	})
+// issuesWithLabel takes a list of issues and returns those issues whose
+// labels match a label filter.
+func issuesWithLabel(issues []octokit.Issue, filter labelFilter) []octokit.Issue {
+	return filterIssues(issues, filter.matches)
 }
 
-func getIssueWithID(issues []octokit.Issue, id int) *octokit.Issue {
+// getIssueWithID finds the issue with a given number in a repository.
+// Repository names are case-insensitive. Returns nil if no such issue
+// exists.
+func getIssueWithID(issues []octokit.Issue, repo string, id int) *octokit.Issue {
 	for _, issue := range issues {
-		if issue.Number == id {
+		if issue.Number == id && strings.EqualFold(issueRepository(issue), repo) {
 			return &issue
 		}
 	}
 	return nil
 }
 
-func pullsWithLabel(pulls []octokit.PullRequest, issues []octokit.Issue, label string) []octokit.PullRequest {
+// pullsWithLabel takes a list of pull requests and returns those which
+// fixed an issue whose labels match a label filter.
+func pullsWithLabel(pulls []octokit.PullRequest, issues []octokit.Issue, filter labelFilter) []octokit.PullRequest {
 	return filterPullRequests(pulls, func(pull octokit.PullRequest) bool {
 		pullRequest := newPull(pull)
-		for _, issueID := range pullRequest.referencedIssues {
-			issue := getIssueWithID(issues, issueID)
-			if issue != nil && hasLabel(*issue, label) {
+		for _, ref := range pullRequest.referencedIssues {
+			issue := getIssueWithID(issues, ref.Repo, ref.Number)
+			if issue != nil && filter.matches(*issue) {
 				return true
 			}
 		}
@@ -258,20 +287,6 @@ func pullsWithLabel(pulls []octokit.PullRequest, issues []octokit.Issue, label s
 	})
 }
 
-// bugsFixedSince returns the number of bugs (issues with the label 'bug') fixed since a given date
-func bugsFixedSince(issues []octokit.Issue, date time.Time) int {
-	return len(filterIssues(issues, func(issue octokit.Issue) bool {
-		return isBug(issue) && issue.ClosedAt != nil && (issue.ClosedAt.After(date) || sameDay(*issue.ClosedAt, date))
-	}))
-}
-
-// issuesFixedSince returns the number of issues fixed since a given date
-func issuesFixedSince(issues []octokit.Issue, date time.Time) int {
-	return len(filterIssues(issues, func(issue octokit.Issue) bool {
-		return issue.ClosedAt != nil && (issue.ClosedAt.After(date) || sameDay(*issue.ClosedAt, date))
-	}))
-}
-
 // get all issues grouped by the user who created the issues.
 func getIssuesGroupedByAuthor(issues []octokit.Issue) map[string][]octokit.Issue {
 	groups := make(map[string][]octokit.Issue)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// fetchProgress reports the progress of several concurrent fetches on a
+// single line.
+type fetchProgress struct {
+	show  bool
+	mutex sync.Mutex
+	// kinds of data being fetched, in the order they were first reported.
+	kinds   []string
+	percent map[string]float64
+}
+
+// newFetchProgress creates a progress reporter. Nothing is reported if
+// show is false.
+func newFetchProgress(show bool) *fetchProgress {
+	return &fetchProgress{show: show, percent: make(map[string]float64)}
+}
+
+// update reports that done out of total units of a kind of data (e.g.
+// issues) have been fetched.
+func (p *fetchProgress) update(kind string, done, total int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.percent[kind]; !ok {
+		p.kinds = append(p.kinds, kind)
+	}
+	p.percent[kind] = 100.0
+	if total > 0 && done < total {
+		p.percent[kind] = 100.0 * float64(done) / float64(total)
+	}
+	p.print()
+}
+
+// log prints a message on its own line.
+func (p *fetchProgress) log(format string, args ...interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.show {
+		fmt.Printf("\n"+format+"\n", args...)
+	}
+}
+
+// finish reports that all fetches are complete.
+func (p *fetchProgress) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, kind := range p.kinds {
+		p.percent[kind] = 100.0
+	}
+	p.print()
+	if p.show && len(p.kinds) > 0 {
+		fmt.Println()
+	}
+}
+
+// print prints the progress of all fetches. The mutex must be held.
+func (p *fetchProgress) print() {
+	if !p.show || len(p.kinds) == 0 {
+		return
+	}
+	var parts []string
+	for _, kind := range p.kinds {
+		parts = append(parts, fmt.Sprintf("%s: %.2f%%", kind, p.percent[kind]))
+	}
+	fmt.Printf("\rFetching %s...", strings.Join(parts, ", "))
+}
@@ -1,38 +1,100 @@
 package main
 
 import (
-	"fmt"
 	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/octokit/go-octokit/octokit"
 )
 
-// list of keywords taken from https://help.github.com/articles/closing-issues-using-keywords/
-const resolvesRegex = "[close | closes | closed | fix | fixes | fixed | resolve | resolves | resolved] #[0-9]+"
+// resolvesRegex matches a closing keyword followed by a reference to an
+// issue, as described in
+// https://help.github.com/articles/closing-issues-using-keywords/
+// The issue may be referenced as #N, owner/repo#N, or by its URL.
+// Submatches are:
+// 1. Issue number (#N)
+// 2. Repository and 3. issue number (owner/repo#N)
+// 4. Repository and 5. issue number (URL)
+const resolvesRegex = `(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+` +
+	`(?:#(\d+)\b|([\w.-]+/[\w.-]+)#(\d+)\b|https?://[^\s/]+/([\w.-]+/[\w.-]+)/issues/(\d+)\b)`
+
+var resolvesRx = regexp.MustCompile(resolvesRegex)
+
+// closingReferences is an index of the issues fixed by each pull
+// request, as reported by github. It is empty for data cached by older
+// versions, which didn't fetch the links.
+var closingReferences = make(linkIndex)
+
+// States of a pull request.
+const (
+	pullOpen   = "open"
+	pullMerged = "merged"
+	// pullClosed is the state of a pull request which was closed
+	// without being merged.
+	pullClosed = "closed"
+)
+
+// pullState returns the state of a pull request: open, merged, or
+// closed without being merged. (Github reports merged pull requests as
+// closed.)
+func pullState(pull octokit.PullRequest) string {
+	if pull.MergedAt != nil {
+		return pullMerged
+	}
+	if pull.ClosedAt != nil {
+		return pullClosed
+	}
+	return pullOpen
+}
 
 type pullRequest struct {
 	pull             octokit.PullRequest
-	referencedIssues []int
+	referencedIssues []issueRef
 }
 
+// newPull creates a pullRequest, and finds the issues which it fixed.
+// These are taken from the issue timelines and the pull request's
+// closing issue references if available (see closingReferences).
+// Otherwise, they are parsed from the closing keywords in the body of
+// the pull request.
 func newPull(base octokit.PullRequest) pullRequest {
 	pull := pullRequest{
 		pull: base,
 	}
-	rx := regexp.MustCompile(resolvesRegex)
-	matches := rx.FindAllString(pull.pull.Body, -1)
-
-	for _, st := range matches {
-		// Get ID/Number of this issue
-		index := strings.Index(st, "#")
-		issueString := st[index+1:]
-		issue, err := strconv.Atoi(issueString)
+	repo := pullRepository(base)
+	if refs, ok := closingReferences[pullKey(repo, base.Number)]; ok {
+		pull.referencedIssues = refs
+	} else {
+		pull.referencedIssues = parseClosingReferences(base.Body, repo)
+	}
+	return pull
+}
+
+// parseClosingReferences finds all issues referenced by closing keywords
+// (e.g. "fixes #12") in the body of a pull request. Issues referenced by
+// number only are assumed to be in the given repository.
+func parseClosingReferences(body, repo string) []issueRef {
+	var refs []issueRef
+	for _, match := range resolvesRx.FindAllStringSubmatch(body, -1) {
+		ref := issueRef{Repo: repo}
+		number := match[1]
+		if match[3] != "" {
+			ref.Repo = match[2]
+			number = match[3]
+		} else if match[5] != "" {
+			ref.Repo = match[4]
+			number = match[5]
+		}
+		// The regex only matches digits, so this cannot fail (unless
+		// the number overflows an int).
+		n, err := strconv.Atoi(number)
 		if err != nil {
-			fmt.Printf("Error getting issue resolved by pull request #%d: %v\n", base.Number, err)
+			continue
+		}
+		ref.Number = n
+		if indexOfRef(refs, ref) < 0 {
+			refs = append(refs, ref)
 		}
-		pull.referencedIssues = append(pull.referencedIssues, issue)
 	}
-	return pull
+	return refs
 }
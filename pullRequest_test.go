@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+func TestPullState(t *testing.T) {
+	closed := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		pull octokit.PullRequest
+		want string
+	}{
+		{octokit.PullRequest{State: "open"}, pullOpen},
+		{octokit.PullRequest{State: "closed", ClosedAt: &closed}, pullClosed},
+		{octokit.PullRequest{State: "closed", ClosedAt: &closed, MergedAt: &closed}, pullMerged},
+	}
+	for _, test := range tests {
+		if got := pullState(test.pull); got != test.want {
+			t.Errorf("pullState(%s, closed %v, merged %v) = %s, want %s", test.pull.State, test.pull.ClosedAt, test.pull.MergedAt, got, test.want)
+		}
+	}
+}
+
+func TestParseClosingReferences(t *testing.T) {
+	tests := []struct {
+		body string
+		want []issueRef
+	}{
+		{"Fixes #12", []issueRef{{"owner/repo", 12}}},
+		{"fix #12", []issueRef{{"owner/repo", 12}}},
+		{"This PR closes #12.", []issueRef{{"owner/repo", 12}}},
+		{"Resolved: #12", []issueRef{{"owner/repo", 12}}},
+		{"closes other/lib#12", []issueRef{{"other/lib", 12}}},
+		{"Closes Other-Org/lib.go#12", []issueRef{{"Other-Org/lib.go", 12}}},
+		{"Resolves https://github.com/other/lib/issues/7", []issueRef{{"other/lib", 7}}},
+		{"fixes http://github.example.com/owner/repo/issues/7", []issueRef{{"owner/repo", 7}}},
+		{"FIXES #3", []issueRef{{"owner/repo", 3}}},
+		{"ReSoLvEs #4", []issueRef{{"owner/repo", 4}}},
+		{"Fixes #1 and closes #2", []issueRef{{"owner/repo", 1}, {"owner/repo", 2}}},
+		{"Fixes #1\nAlso fixes #1", []issueRef{{"owner/repo", 1}}},
+		{"e #12", nil},
+		{"see #12", nil},
+		{"prefixes #12", nil},
+		{"fixes #12abc", nil},
+		{"fixes issue #12", nil},
+		{"fixes https://github.com/owner/repo/pull/12", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		got := parseClosingReferences(test.body, "owner/repo")
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("parseClosingReferences(%q) = %v, want %v", test.body, got, test.want)
+		}
+	}
+}
+
+func TestNewPullClosingReferences(t *testing.T) {
+	saved := closingReferences
+	defer func() { closingReferences = saved }()
+	closingReferences = newLinkIndex([]issueLink{
+		{IssueRepo: "Owner/Repo", Issue: 5, PullRepo: "Owner/Repo", Pull: 13, Source: linkFromClosingReference},
+	})
+
+	// The links take precedence over the body, and the repository names
+	// are matched regardless of case.
+	pull := newPull(octokit.PullRequest{
+		URL:    "https://api.github.com/repos/owner/repo/pulls/13",
+		Number: 13,
+		Body:   "Fixes #12",
+	})
+	if want := []issueRef{{"Owner/Repo", 5}}; fmt.Sprint(pull.referencedIssues) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", pull.referencedIssues, want)
+	}
+
+	// Without links, the body is parsed.
+	pull = newPull(octokit.PullRequest{
+		URL:    "https://api.github.com/repos/owner/repo/pulls/14",
+		Number: 14,
+		Body:   "Fixes #12",
+	})
+	if want := []issueRef{{"owner/repo", 12}}; fmt.Sprint(pull.referencedIssues) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", pull.referencedIssues, want)
+	}
+}
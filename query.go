@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// queryItem holds the fields of an issue or pull request which a query
+// can filter on.
+type queryItem struct {
+	author    string
+	assignee  string
+	milestone string
+	// hasMilestone is false for pull requests, whose milestones aren't
+	// fetched.
+	hasMilestone bool
+	// state is open or closed, or merged for a merged pull request.
+	state     string
+	createdAt time.Time
+	closedAt  *time.Time
+	comments  int
+	// hasComments is false for pull requests, whose number of comments
+	// isn't returned by the REST API.
+	hasComments bool
+	title       string
+	body        string
+}
+
+func issueQueryItem(issue octokit.Issue) queryItem {
+	state := pullOpen
+	if issue.ClosedAt != nil {
+		state = pullClosed
+	}
+	return queryItem{
+		author:       issue.User.Login,
+		assignee:     issue.Assignee.Login,
+		milestone:    issue.Milestone.Title,
+		hasMilestone: true,
+		state:        state,
+		createdAt:    issue.CreatedAt,
+		closedAt:     issue.ClosedAt,
+		comments:     issue.Comments,
+		hasComments:  true,
+		title:        issue.Title,
+		body:         issue.Body,
+	}
+}
+
+func pullQueryItem(pull octokit.PullRequest) queryItem {
+	item := queryItem{
+		author:    pull.User.Login,
+		state:     pullState(pull),
+		createdAt: pull.CreatedAt,
+		closedAt:  pull.ClosedAt,
+		title:     pull.Title,
+		body:      pull.Body,
+	}
+	if pull.Assignee != nil {
+		item.assignee = pull.Assignee.Login
+	}
+	return item
+}
+
+// query is a filter on issues and pull requests, given by the --where
+// option. An issue or pull request matches the query if it matches all
+// of the query's terms.
+type query []func(queryItem) bool
+
+func (q query) matches(item queryItem) bool {
+	for _, term := range q {
+		if !term(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesIssue checks if an issue matches the query.
+func (q query) matchesIssue(issue octokit.Issue) bool {
+	return q.matches(issueQueryItem(issue))
+}
+
+// matchesPull checks if a pull request matches the query.
+func (q query) matchesPull(pull octokit.PullRequest) bool {
+	return q.matches(pullQueryItem(pull))
+}
+
+// queryTermRx matches a term of a query: an optional -, a field name,
+// : or ~, and a value which may be double-quoted.
+var queryTermRx = regexp.MustCompile(`^\s*(-?)(\w+)([:~])("[^"]*"|[^\s"]*)`)
+
+// parseQuery parses a query. A query consists of terms separated by
+// spaces, each of which is one of:
+//   - field:value, which matches items whose field is the value (ignoring
+//     case). The author, assignee, milestone, state, title and body
+//     fields may be used.
+//   - field~value, which matches items whose field contains the value
+//     (ignoring case).
+//   - created:date or closed:date, which match items created or closed
+//     on a date (or in a month, quarter, etc.). The date may be preceded
+//     by >, >=, < or <= to match items created or closed after or before
+//     it. Dates are in the same forms as --since.
+//   - comments:n, which matches items with n comments. n may be preceded
+//     by >, >=, < or <=.
+//
+// A term preceded by - matches items which don't match the term. The
+// state of an issue is open or closed, and the state of a pull request
+// is open, closed or merged. Pull requests have no milestone or number
+// of comments, so terms on these are ignored for pull requests, even if
+// preceded by -. Relative dates are relative to now.
+func parseQuery(expr string, now time.Time) (query, error) {
+	var q query
+	for rest := expr; strings.TrimSpace(rest) != ""; {
+		match := queryTermRx.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("invalid query '%s': expected field:value at '%s'", expr, strings.TrimSpace(rest))
+		}
+		rest = rest[len(match[0]):]
+		term, err := parseQueryTerm(strings.ToLower(match[2]), match[3], strings.Trim(match[4], `"`), now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query '%s': %w", expr, err)
+		}
+		if match[1] == "-" {
+			positive := term
+			term = func(item queryItem) bool { return !positive(item) }
+		}
+		if applies, ok := queryFieldApplies[strings.ToLower(match[2])]; ok {
+			applicable := term
+			term = func(item queryItem) bool { return !applies(item) || applicable(item) }
+		}
+		q = append(q, term)
+	}
+	return q, nil
+}
+
+// queryFieldApplies holds the fields which some items don't have, and
+// checks if an item has each of them. Terms on these fields match the
+// items which don't have them.
+var queryFieldApplies = map[string]func(queryItem) bool{
+	"milestone": func(item queryItem) bool { return item.hasMilestone },
+	"comments":  func(item queryItem) bool { return item.hasComments },
+}
+
+// queryComparisonRx splits a value into a comparison operator and the
+// value to compare against.
+var queryComparisonRx = regexp.MustCompile(`^(>=|<=|>|<)?(.*)$`)
+
+// parseQueryTerm parses a term of a query, given its field, operator (:
+// or ~) and value. Relative dates are relative to now.
+func parseQueryTerm(field, operator, value string, now time.Time) (func(queryItem) bool, error) {
+	text := map[string]func(queryItem) string{
+		"author":    func(item queryItem) string { return item.author },
+		"assignee":  func(item queryItem) string { return item.assignee },
+		"milestone": func(item queryItem) string { return item.milestone },
+		"state":     func(item queryItem) string { return item.state },
+		"title":     func(item queryItem) string { return item.title },
+		"body":      func(item queryItem) string { return item.body },
+	}
+	if get, ok := text[field]; ok {
+		match := func(item queryItem) bool {
+			if operator == "~" {
+				return strings.Contains(strings.ToLower(get(item)), strings.ToLower(value))
+			}
+			return strings.EqualFold(get(item), value)
+		}
+		if field != "state" || operator != ":" {
+			return match, nil
+		}
+		switch strings.ToLower(value) {
+		case pullOpen, pullMerged:
+			return match, nil
+		case pullClosed:
+			// Merged pull requests are closed too.
+			return func(item queryItem) bool { return item.closedAt != nil }, nil
+		}
+		return nil, fmt.Errorf("invalid state '%s' (expected %s, %s or %s)", value, pullOpen, pullClosed, pullMerged)
+	}
+
+	if operator != ":" {
+		return nil, fmt.Errorf("%s%s: only text fields can be searched with ~", field, operator)
+	}
+	comparison := queryComparisonRx.FindStringSubmatch(value)
+	switch field {
+	case "created", "closed":
+		start, end, err := parseDateRange(comparison[2], now)
+		if err != nil {
+			return nil, err
+		}
+		if end == start {
+			// An instant, rather than a range of time.
+			end = start.Add(time.Nanosecond)
+		}
+		inRange := func(t time.Time) bool {
+			switch comparison[1] {
+			case ">":
+				return !t.Before(end)
+			case ">=":
+				return !t.Before(start)
+			case "<":
+				return t.Before(start)
+			case "<=":
+				return t.Before(end)
+			}
+			return !t.Before(start) && t.Before(end)
+		}
+		if field == "created" {
+			return func(item queryItem) bool { return inRange(item.createdAt) }, nil
+		}
+		return func(item queryItem) bool { return item.closedAt != nil && inRange(*item.closedAt) }, nil
+	case "comments":
+		n, err := strconv.Atoi(comparison[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid number of comments '%s'", comparison[2])
+		}
+		return func(item queryItem) bool {
+			switch comparison[1] {
+			case ">":
+				return item.comments > n
+			case ">=":
+				return item.comments >= n
+			case "<":
+				return item.comments < n
+			case "<=":
+				return item.comments <= n
+			}
+			return item.comments == n
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown field '%s' (expected author, assignee, milestone, state, created, closed, comments, title or body)", field)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	closed := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	oldClosed := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	issue := queryItem{
+		author:       "hol430",
+		assignee:     "bob",
+		milestone:    "v1.0",
+		hasMilestone: true,
+		state:        pullClosed,
+		createdAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		closedAt:     &closed,
+		comments:     3,
+		hasComments:  true,
+		title:        "Soil water is wrong",
+		body:         "The soil water balance doesn't add up.",
+	}
+	old := queryItem{
+		author:       "alice",
+		hasMilestone: true,
+		state:        pullClosed,
+		createdAt:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		closedAt:     &oldClosed,
+		hasComments:  true,
+		title:        "Wheat phenology",
+	}
+	open := queryItem{
+		author:       "Hol430",
+		hasMilestone: true,
+		state:        pullOpen,
+		createdAt:    time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC),
+		comments:     10,
+		hasComments:  true,
+		title:        "Soil temperature",
+	}
+	merged := queryItem{
+		author:    "hol430",
+		state:     pullMerged,
+		createdAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		closedAt:  &closed,
+		title:     "Fix soil water",
+	}
+	items := map[string]queryItem{"issue": issue, "old": old, "open": open, "merged": merged}
+
+	tests := []struct {
+		expr string
+		// want lists the names of the matching items, in alphabetical
+		// order.
+		want string
+	}{
+		// The example in the readme.
+		{`author:hol430 state:closed closed:>2024-01-01 title~"Soil"`, "issue merged"},
+		{"", "issue merged old open"},
+		{"author:HOL430", "issue merged open"},
+		{"-author:hol430", "old"},
+		{"author~hol", "issue merged open"},
+		{"assignee:bob", "issue"},
+		{`assignee:""`, "merged old open"},
+		// Pull requests have no milestone, so milestone terms are ignored.
+		{"milestone:v1.0", "issue merged"},
+		{"milestone~v1", "issue merged"},
+		{"-milestone:v1.0", "merged old open"},
+		{"state:open", "open"},
+		{"state:closed", "issue merged old"},
+		{"state:Merged", "merged"},
+		{"-state:closed", "open"},
+		{"created:2024", "issue merged"},
+		{"created:2024-01", "issue"},
+		{"created:2024-01-01", "issue"},
+		{"created:>2024-01-01", "merged open"},
+		{"created:>=2024-01-01", "issue merged open"},
+		{"created:<2024-01-01", "old"},
+		{"created:<=2024-01-01", "issue old"},
+		{"created:>=2025-08-01T00:00:00Z", "open"},
+		{"created:>30d", "open"},
+		{"created:this-year", "open"},
+		{"closed:2024-Q1", "issue merged"},
+		{"closed:<2024-01-01", "old"},
+		{"-closed:2024", "old open"},
+		// Nor do they have a number of comments.
+		{"comments:3", "issue merged"},
+		{"comments:>3", "merged open"},
+		{"comments:>=3", "issue merged open"},
+		{"comments:<3", "merged old"},
+		{"comments:<=3", "issue merged old"},
+		{"comments:0", "merged old"},
+		{"-comments:0", "issue merged open"},
+		{`title:"Soil temperature"`, "open"},
+		{"title:soil", ""},
+		{"title~WATER", "issue merged"},
+		{"body~balance", "issue"},
+		{"  TITLE~soil   -state:open  ", "issue merged"},
+	}
+	now := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		q, err := parseQuery(test.expr, now)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", test.expr, err)
+			continue
+		}
+		var matched []string
+		for _, name := range []string{"issue", "merged", "old", "open"} {
+			if q.matches(items[name]) {
+				matched = append(matched, name)
+			}
+		}
+		if got := strings.Join(matched, " "); got != test.want {
+			t.Errorf("parseQuery(%q) matches [%s], want [%s]", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		// want is a part of the expected error message.
+		want string
+	}{
+		{"hol430", "expected field:value at 'hol430'"},
+		{"author:hol430 closed", "expected field:value at 'closed'"},
+		{`title~"Soil`, `expected field:value at '"Soil'`},
+		{"author=hol430", "expected field:value"},
+		{"colour:red", "unknown field 'colour'"},
+		{"state:pending", "invalid state 'pending'"},
+		{"created~2024", "only text fields can be searched with ~"},
+		{"comments~3", "only text fields can be searched with ~"},
+		{"created:someday", "invalid date 'someday'"},
+		{"closed:>", "invalid date ''"},
+		{"comments:many", "invalid number of comments 'many'"},
+		{"comments:>=", "invalid number of comments ''"},
+	}
+	for _, test := range tests {
+		_, err := parseQuery(test.expr, time.Now())
+		if err == nil {
+			t.Errorf("parseQuery(%q): expected an error", test.expr)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseQuery(%q): got error %q, want %q", test.expr, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// reportMetric is a statistic shown in the report.
+type reportMetric struct {
+	// name identifies the metric in the --window option.
+	name string
+	// label describes the metric in the report.
+	label string
+	// semantics are the default window semantics of the metric (see
+	// windowSemantics).
+	semantics string
+	// issues counts the issues selected by the window. Set for metrics
+	// about issues.
+	issues func([]octokit.Issue) int
+	// pulls counts the pull requests selected by the window. Set for
+	// metrics about pull requests.
+	pulls func([]octokit.PullRequest) int
+}
+
+// reportMetrics returns the statistics shown in the report, in order.
+func reportMetrics() []reportMetric {
+	return []reportMetric{
+		{"open-issues", "Number of open issues", windowCreated, getNumOpenIssues, nil},
+		{"closed-issues", "Number of closed issues", windowCreated, getNumClosedIssues, nil},
+		{"open-pulls", "Number of open pull requests", windowCreated, nil, getNumOpenPullRequests},
+		{"closed-pulls", "Number of closed pull requests", windowCreated, nil, getNumClosedPullRequests},
+		{"merged-pulls", "    merged", windowCreated, nil, func(pulls []octokit.PullRequest) int {
+			return getNumPullRequestsInState(pulls, pullMerged)
+		}},
+		{"unmerged-pulls", "    closed without merging", windowCreated, nil, func(pulls []octokit.PullRequest) int {
+			return getNumPullRequestsInState(pulls, pullClosed)
+		}},
+		{"user-issues", fmt.Sprintf("Number of issues opened by %s", settings.Username), windowCreated, func(issues []octokit.Issue) int {
+			return getNumIssuesOpenedBy(issues, settings.Username)
+		}, nil},
+		{"bugs-closed", "Number of bugs closed", windowClosed, func(issues []octokit.Issue) int {
+			return getNumClosedIssues(filterIssues(issues, isBug))
+		}, nil},
+		{"issues-closed", "Number of issues closed", windowClosed, getNumClosedIssues, nil},
+	}
+}
+
+// metricSemantics returns the window semantics of each report metric,
+// keyed by metric name. These are given by the --window option, which
+// is either metric=semantics, or just the semantics for all metrics.
+// Otherwise, the metric's default semantics are used.
+func (o options) metricSemantics() (map[string]string, error) {
+	result := make(map[string]string)
+	for _, metric := range reportMetrics() {
+		result[metric.name] = metric.semantics
+	}
+	for _, value := range o.Windows {
+		name, semantics := "", value
+		if i := strings.Index(value, "="); i >= 0 {
+			name, semantics = strings.TrimSpace(value[:i]), value[i+1:]
+		}
+		semantics = strings.ToLower(strings.TrimSpace(semantics))
+		if indexOfString(windowSemantics, semantics) < 0 {
+			return nil, fmt.Errorf("invalid window semantics '%s' in --window %s (expected one of %s)",
+				semantics, value, strings.Join(windowSemantics, ", "))
+		}
+		if name == "" {
+			for metric := range result {
+				result[metric] = semantics
+			}
+			continue
+		}
+		if _, ok := result[name]; !ok {
+			var names []string
+			for _, metric := range reportMetrics() {
+				names = append(names, metric.name)
+			}
+			return nil, fmt.Errorf("unknown metric '%s' in --window %s (expected one of %s)",
+				name, value, strings.Join(names, ", "))
+		}
+		result[name] = semantics
+	}
+	return result, nil
+}
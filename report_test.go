@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricSemantics(t *testing.T) {
+	tests := []struct {
+		windows []string
+		// all is the expected semantics of the metrics which aren't in
+		// want, or empty if they have their default semantics.
+		all  string
+		want map[string]string
+	}{
+		{nil, "", nil},
+		{[]string{"active"}, windowActive, nil},
+		{[]string{"open-issues=active"}, "", map[string]string{"open-issues": windowActive}},
+		{[]string{" open-issues = Active "}, "", map[string]string{"open-issues": windowActive}},
+		{[]string{"closed", "open-pulls=created"}, windowClosed, map[string]string{"open-pulls": windowCreated}},
+		// A later --window overrides an earlier one.
+		{[]string{"open-pulls=created", "closed"}, windowClosed, nil},
+	}
+	for _, test := range tests {
+		got, err := options{Windows: test.windows}.metricSemantics()
+		if err != nil {
+			t.Errorf("--window %v: %v", test.windows, err)
+			continue
+		}
+		for _, metric := range reportMetrics() {
+			want, ok := test.want[metric.name]
+			if !ok {
+				want = test.all
+			}
+			if want == "" {
+				want = metric.semantics
+			}
+			if got[metric.name] != want {
+				t.Errorf("--window %v: %s has semantics %s, want %s", test.windows, metric.name, got[metric.name], want)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		window string
+		// want is a part of the expected error message.
+		want string
+	}{
+		{"opened", "invalid window semantics 'opened'"},
+		{"open-issues=", "invalid window semantics ''"},
+		{"open-bugs=active", "unknown metric 'open-bugs'"},
+	} {
+		_, err := options{Windows: []string{test.window}}.metricSemantics()
+		if err == nil {
+			t.Errorf("--window %s: expected an error", test.window)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("--window %s: got error %q, want %q", test.window, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// repository identifies a github repository.
+type repository struct {
+	Owner string
+	Name  string
+}
+
+// parseRepository parses a repository of the form owner/repo.
+func parseRepository(s string) (repository, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return repository{}, fmt.Errorf("invalid repository '%s': expected owner/repo", s)
+	}
+	return repository{Owner: parts[0], Name: parts[1]}, nil
+}
+
+// String returns the full name of the repository (owner/repo).
+func (r repository) String() string {
+	return r.Owner + "/" + r.Name
+}
+
+// repositoryFromURL extracts the full name (owner/repo) of a repository
+// from the API URL of an issue or pull request. Returns an empty string
+// if the URL does not refer to a repository.
+func repositoryFromURL(url string) string {
+	index := strings.Index(url, "repos/")
+	if index < 0 {
+		return ""
+	}
+	parts := strings.SplitN(url[index+len("repos/"):], "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// issueRepository returns the full name of the repository to which an
+// issue belongs.
+func issueRepository(issue octokit.Issue) string {
+	return repositoryFromURL(issue.URL)
+}
+
+// pullRepository returns the full name of the repository to which a
+// pull request belongs.
+func pullRepository(pull octokit.PullRequest) string {
+	return repositoryFromURL(pull.URL)
+}
+
+// repositoryGroup is a set of issues and pull requests which are graphed
+// together.
+type repositoryGroup struct {
+	name   string
+	issues []octokit.Issue
+	pulls  []octokit.PullRequest
+}
+
+// seriesName returns the name of a series for this group. If the group
+// belongs to a single repository, the series name is prefixed by the
+// name of the repository.
+func (g repositoryGroup) seriesName(name string) string {
+	if g.name == "" {
+		return name
+	}
+	return fmt.Sprintf("%s: %s", g.name, name)
+}
+
+// groupByRepository splits issues and pull requests into one group per
+// repository, sorted by repository name. Each repository being reported
+// on has a group, even if it has no issues or pull requests (e.g. within
+// the date window), so that every graph has at least one series. If the
+// per-repo option is not set, all data is aggregated into a single
+// unnamed group.
+func groupByRepository(issues []octokit.Issue, pulls []octokit.PullRequest) []repositoryGroup {
+	if !settings.PerRepo {
+		return []repositoryGroup{{issues: issues, pulls: pulls}}
+	}
+
+	// Groups are keyed by lower case name, as github returns the
+	// canonical case of a repository's name, which may differ from the
+	// case given by the user.
+	groups := make(map[string]*repositoryGroup)
+	group := func(name string) *repositoryGroup {
+		key := strings.ToLower(name)
+		if _, ok := groups[key]; !ok {
+			groups[key] = &repositoryGroup{name: name}
+		}
+		return groups[key]
+	}
+	for _, repo := range parsed.repositories {
+		group(repo.String())
+	}
+	for _, issue := range issues {
+		g := group(issueRepository(issue))
+		g.issues = append(g.issues, issue)
+	}
+	for _, pull := range pulls {
+		g := group(pullRepository(pull))
+		g.pulls = append(g.pulls, pull)
+	}
+
+	var keys []string
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]repositoryGroup, len(keys))
+	for i, key := range keys {
+		result[i] = *groups[key]
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    repository
+		wantErr bool
+	}{
+		{"APSIMInitiative/ApsimX", repository{"APSIMInitiative", "ApsimX"}, false},
+		{"owner/repo.go", repository{"owner", "repo.go"}, false},
+		{"ApsimX", repository{}, true},
+		{"/ApsimX", repository{}, true},
+		{"APSIMInitiative/", repository{}, true},
+		{"a/b/c", repository{}, true},
+		{"", repository{}, true},
+	}
+	for _, test := range tests {
+		got, err := parseRepository(test.s)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("parseRepository(%q) = %v (%v), want %v", test.s, got, err, test.want)
+		}
+	}
+}
+
+func TestRepositoryFromURL(t *testing.T) {
+	tests := []struct{ url, want string }{
+		{"https://api.github.com/repos/owner/repo/issues/12", "owner/repo"},
+		{"https://github.example.com/api/v3/repos/owner/repo/pulls/13", "owner/repo"},
+		{"https://api.github.com/repos/owner", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := repositoryFromURL(test.url); got != test.want {
+			t.Errorf("repositoryFromURL(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestGroupByRepository(t *testing.T) {
+	issue := func(repo string, number int) octokit.Issue {
+		return octokit.Issue{URL: fmt.Sprintf("https://api.github.com/repos/%s/issues/%d", repo, number), Number: number}
+	}
+	pull := func(repo string, number int) octokit.PullRequest {
+		return octokit.PullRequest{URL: fmt.Sprintf("https://api.github.com/repos/%s/pulls/%d", repo, number), Number: number}
+	}
+	issues := []octokit.Issue{issue("owner/b", 1), issue("Owner/A", 2), issue("owner/b", 3)}
+	pulls := []octokit.PullRequest{pull("owner/a", 4)}
+
+	saved, savedParsed := settings, parsed
+	defer func() { settings, parsed = saved, savedParsed }()
+	parsed.repositories = []repository{{"owner", "a"}, {"owner", "b"}, {"owner", "c"}}
+
+	settings.PerRepo = false
+	groups := groupByRepository(issues, pulls)
+	if len(groups) != 1 || groups[0].name != "" || len(groups[0].issues) != 3 || len(groups[0].pulls) != 1 {
+		t.Errorf("got %d groups, want all data in one unnamed group", len(groups))
+	}
+	if name := groups[0].seriesName("Open issues"); name != "Open issues" {
+		t.Errorf("got series name %q, want the unprefixed name", name)
+	}
+
+	// Each repository has a group, even if it has no data, and names are
+	// matched regardless of case.
+	settings.PerRepo = true
+	var got []string
+	for _, group := range groupByRepository(issues, pulls) {
+		got = append(got, fmt.Sprintf("%s %v %d", group.name, issueNumbers(group.issues), len(group.pulls)))
+	}
+	want := "[owner/a [2] 1 owner/b [1 3] 0 owner/c [] 0]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("got groups %v, want %s", got, want)
+	}
+}
+
+func issueNumbers(issues []octokit.Issue) []int {
+	var numbers []int
+	for _, issue := range issues {
+		numbers = append(numbers, issue.Number)
+	}
+	return numbers
+}
@@ -5,7 +5,8 @@ import "gonum.org/v1/plot/plotter"
 // series encapsulates a dataset which can be graphed.
 type series interface {
 	// getXYPairs returns the graph's XY data as a plotter.XYs object.
-	getXYPairs() plotter.XYs
+	// Returns an error if the data is invalid.
+	getXYPairs() (plotter.XYs, error)
 
 	// getName returns the series' name to be used in the legend.
 	getName() string
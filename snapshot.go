@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// snapshotDir is the directory which holds the snapshots of each
+// repository. Each time data is fetched, it is stored as a snapshot in
+// snapshotDir/OWNER.REPO/TIME, where TIME is the time of the fetch (see
+// snapshotTimeFormat), unless --no-snapshot is given. A snapshot holds
+// the issues, pulls and links cache files, which are compressed and
+// stripped in the same way as the cache.
+const snapshotDir = ".snapshots"
+
+// snapshotTimeFormat is the format of the names of snapshot directories.
+const snapshotTimeFormat = "20060102T150405Z"
+
+// repositorySnapshotDir returns the directory which holds the snapshots
+// of a repository.
+func repositorySnapshotDir(repo repository) string {
+	return filepath.Join(snapshotDir, repo.Owner+"."+repo.Name)
+}
+
+// snapshotFileName returns the name of the file which holds a given kind
+// of data (e.g. issuesCache) in a snapshot of a repository.
+func snapshotFileName(repo repository, taken time.Time, kind string) string {
+	return filepath.Join(repositorySnapshotDir(repo), taken.UTC().Format(snapshotTimeFormat), kind)
+}
+
+// writeSnapshot stores the data fetched from a repository at a given
+// time as a snapshot.
+func writeSnapshot(repo repository, taken time.Time, issues []octokit.Issue, pulls []octokit.PullRequest, links []issueLink) error {
+	dir := filepath.Dir(snapshotFileName(repo, taken, issuesCache))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return cacheError(dir, err)
+	}
+	header := newCacheHeader(repo, taken)
+	if err := writeIssuesToCache(snapshotFileName(repo, taken, issuesCache), header, issues); err != nil {
+		return err
+	}
+	if err := writeToCache(snapshotFileName(repo, taken, pullsCache), header, pulls); err != nil {
+		return err
+	}
+	return writeLinksToCache(snapshotFileName(repo, taken, linksCache), header, links)
+}
+
+// listSnapshots returns the times at which the snapshots of a repository
+// were taken, in chronological order.
+func listSnapshots(repo repository) ([]time.Time, error) {
+	dir := repositorySnapshotDir(repo)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, cacheError(dir, err)
+	}
+	var times []time.Time
+	for _, entry := range entries {
+		taken, err := time.Parse(snapshotTimeFormat, entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// Snapshots interrupted before they were complete have no
+		// links file, as this is written last.
+		if fileExists(snapshotFileName(repo, taken, linksCache)) {
+			times = append(times, taken)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
+
+// pruneSnapshots deletes all but the latest keep snapshots of a
+// repository. If keep is zero, all snapshots are kept.
+func pruneSnapshots(repo repository, keep int) error {
+	times, err := listSnapshots(repo)
+	if err != nil || keep == 0 || len(times) <= keep {
+		return err
+	}
+	for _, taken := range times[:len(times)-keep] {
+		dir := filepath.Dir(snapshotFileName(repo, taken, issuesCache))
+		if err := os.RemoveAll(dir); err != nil {
+			return cacheError(dir, err)
+		}
+	}
+	return nil
+}
+
+// snapshotDeadline returns the time before which a snapshot must have
+// been taken to be used for a date given by the user. The date may be in
+// any of the forms accepted by --since, and includes the whole of a day,
+// month, etc. Relative dates are relative to now.
+func snapshotDeadline(date string, now time.Time) (time.Time, error) {
+	start, end, err := parseDateRange(date, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end.Equal(start) {
+		// An instant, rather than a range of time.
+		end = end.Add(time.Nanosecond)
+	}
+	return end, nil
+}
+
+// findSnapshot returns the time at which the latest snapshot of a
+// repository taken before a deadline (see snapshotDeadline) was taken.
+// date is the date given by the user, from which the deadline was
+// calculated.
+func findSnapshot(repo repository, date string, deadline time.Time) (time.Time, error) {
+	times, err := listSnapshots(repo)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for i := len(times) - 1; i >= 0; i-- {
+		if times[i].Before(deadline) {
+			return times[i], nil
+		}
+	}
+	if len(times) == 0 {
+		return time.Time{}, withExitCode(exitCacheFailure, fmt.Errorf("there are no snapshots of %s", repo))
+	}
+	return time.Time{}, withExitCode(exitCacheFailure, fmt.Errorf("there is no snapshot of %s from %s or earlier (the earliest is from %s)",
+		repo, date, times[0].Local().Format(time.RFC1123)))
+}
+
+// readSnapshot reads the data in a snapshot of a repository. Snapshots
+// of data fetched from a different github host are refused.
+func readSnapshot(repo repository, taken time.Time) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error) {
+	fileName := snapshotFileName(repo, taken, issuesCache)
+	header, err := readCacheHeader(fileName, issuesCache, repo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if apiURL := defaultAPIURL(header.APIURL); apiURL != settings.apiURL() {
+		return nil, nil, nil, cacheError(fileName, fmt.Errorf("the snapshot of %s taken at %s holds data from %s, not %s",
+			repo, taken.Local().Format(time.RFC1123), apiURL, settings.apiURL()))
+	}
+	issues, pulls, err := getDataFromCache(
+		snapshotFileName(repo, taken, issuesCache),
+		snapshotFileName(repo, taken, pullsCache), repo, time.Time{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	links, err := linksFromCache(snapshotFileName(repo, taken, linksCache), repo, time.Time{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return issues, pulls, links, nil
+}
+
+// snapshotItem holds the details of an issue or pull request which are
+// compared by a snapshot diff.
+type snapshotItem struct {
+	number   int
+	title    string
+	state    string
+	labels   []string
+	assignee string
+}
+
+// issueSnapshotItems returns the details of issues which are compared
+// by a snapshot diff.
+func issueSnapshotItems(issues []octokit.Issue) []snapshotItem {
+	items := make([]snapshotItem, len(issues))
+	for i, issue := range issues {
+		items[i] = snapshotItem{number: issue.Number, title: issue.Title, state: issue.State, assignee: issue.Assignee.Login}
+		for _, label := range issue.Labels {
+			items[i].labels = append(items[i].labels, label.Name)
+		}
+	}
+	return items
+}
+
+// pullSnapshotItems returns the details of pull requests which are
+// compared by a snapshot diff. The labels of pull requests aren't
+// fetched, so they never change.
+func pullSnapshotItems(pulls []octokit.PullRequest) []snapshotItem {
+	items := make([]snapshotItem, len(pulls))
+	for i, pull := range pulls {
+		items[i] = snapshotItem{number: pull.Number, title: pull.Title, state: pullState(pull)}
+		if pull.Assignee != nil {
+			items[i].assignee = pull.Assignee.Login
+		}
+	}
+	return items
+}
+
+// summary describes an issue or pull request for a snapshot diff.
+func (item snapshotItem) summary() string {
+	return fmt.Sprintf("#%d %s", item.number, item.title)
+}
+
+// assigneeName returns an assignee's login for a snapshot diff.
+func assigneeName(login string) string {
+	if login == "" {
+		return "(none)"
+	}
+	return login
+}
+
+// diffIssues describes the changes between the issues in two snapshots
+// (see diffItems).
+func diffIssues(before, after []octokit.Issue) []string {
+	return diffItems(issueSnapshotItems(before), issueSnapshotItems(after))
+}
+
+// diffPulls describes the changes between the pull requests in two
+// snapshots (see diffItems).
+func diffPulls(before, after []octokit.PullRequest) []string {
+	return diffItems(pullSnapshotItems(before), pullSnapshotItems(after))
+}
+
+// diffItems describes the changes to the state, labels and assignee of
+// issues or pull requests between two snapshots, in order of number.
+// Items which were opened, or which are missing from the later snapshot
+// (e.g. because they were transferred), are also described.
+func diffItems(before, after []snapshotItem) []string {
+	previous := make(map[int]snapshotItem)
+	for _, item := range before {
+		previous[item.number] = item
+	}
+	sorted := append([]snapshotItem(nil), after...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].number < sorted[j].number })
+
+	var changes []string
+	for _, item := range sorted {
+		summary := item.summary()
+		old, ok := previous[item.number]
+		delete(previous, item.number)
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s: new (%s)", summary, item.state))
+			continue
+		}
+		if old.state != item.state {
+			changes = append(changes, fmt.Sprintf("%s: state %s -> %s", summary, old.state, item.state))
+		}
+		if added, removed := diffLabels(old.labels, item.labels); len(added)+len(removed) > 0 {
+			var labels []string
+			for _, label := range added {
+				labels = append(labels, "+"+label)
+			}
+			for _, label := range removed {
+				labels = append(labels, "-"+label)
+			}
+			changes = append(changes, fmt.Sprintf("%s: labels %s", summary, strings.Join(labels, " ")))
+		}
+		if old.assignee != item.assignee {
+			changes = append(changes, fmt.Sprintf("%s: assignee %s -> %s", summary,
+				assigneeName(old.assignee), assigneeName(item.assignee)))
+		}
+	}
+	var missing []snapshotItem
+	for _, item := range previous {
+		missing = append(missing, item)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].number < missing[j].number })
+	for _, item := range missing {
+		changes = append(changes, fmt.Sprintf("%s: no longer present", item.summary()))
+	}
+	return changes
+}
+
+// diffLabels returns the labels which were added and removed between
+// two sets of labels, in alphabetical order.
+func diffLabels(before, after []string) (added, removed []string) {
+	had := make(map[string]bool)
+	for _, label := range before {
+		had[label] = true
+	}
+	for _, label := range after {
+		if !had[label] {
+			added = append(added, label)
+		}
+		delete(had, label)
+	}
+	for label := range had {
+		removed = append(removed, label)
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
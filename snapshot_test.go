@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+func TestSnapshotCompressedAndStripped(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	settings.Compress = true
+	settings.StripFields = true
+	repo := repository{Owner: "owner", Name: "repo"}
+	taken := date(2025, 7, 1)
+	issue := labeledIssue("bug")
+	issue.Number = 1
+	issue.Labels[0].Color = "ff0000"
+	if err := writeSnapshot(repo, taken, []octokit.Issue{issue}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(snapshotFileName(repo, taken, issuesCache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(contents, []byte{0x1f, 0x8b}) {
+		t.Error("the snapshot isn't compressed")
+	}
+	header, err := readCacheHeader(snapshotFileName(repo, taken, issuesCache), issuesCache, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.Stripped {
+		t.Error("the snapshot isn't stripped")
+	}
+	issues, _, _, err := readSnapshot(repo, taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].Labels[0].Name != "bug" || issues[0].Labels[0].Color != "" {
+		t.Errorf("got issues %v, want issue 1 labelled bug without a colour", issueNumbers(issues))
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	repo := repository{Owner: "owner", Name: "repo"}
+	for day := 1; day <= 4; day++ {
+		if err := writeSnapshot(repo, date(2025, 7, day), nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneSnapshots(repo, 0); err != nil {
+		t.Fatal(err)
+	}
+	if times, _ := listSnapshots(repo); len(times) != 4 {
+		t.Errorf("got %d snapshots after pruning with no limit, want 4", len(times))
+	}
+
+	if err := pruneSnapshots(repo, 2); err != nil {
+		t.Fatal(err)
+	}
+	times, err := listSnapshots(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 2 || !times[0].Equal(date(2025, 7, 3)) || !times[1].Equal(date(2025, 7, 4)) {
+		t.Errorf("got snapshots %v, want the latest two", times)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	open := testIssue(1)
+	labelled := labeledIssue("bug", "wheat")
+	labelled.Number, labelled.Title, labelled.State = 2, "Labelled", "open"
+	relabelled := labeledIssue("bug", "sugarcane")
+	relabelled.Number, relabelled.Title, relabelled.State = 2, "Labelled", "closed"
+	relabelled.Assignee.Login = "bob"
+
+	got := diffIssues([]octokit.Issue{open, labelled}, []octokit.Issue{relabelled, testIssue(3)})
+	want := []string{
+		"#2 Labelled: state open -> closed",
+		"#2 Labelled: labels +sugarcane -wheat",
+		"#2 Labelled: assignee (none) -> bob",
+		"#3 Issue 3: new (open)",
+		"#1 Issue 1: no longer present",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got issue changes\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	merged := time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)
+	before := octokit.PullRequest{Number: 5, Title: "Fix", State: "open"}
+	after := octokit.PullRequest{Number: 5, Title: "Fix", State: "closed", MergedAt: &merged, Assignee: &octokit.User{Login: "alice"}}
+	got = diffPulls([]octokit.PullRequest{before}, []octokit.PullRequest{after})
+	want = []string{
+		"#5 Fix: state open -> merged",
+		"#5 Fix: assignee (none) -> alice",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got pull request changes\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReadSnapshotFromOtherHost(t *testing.T) {
+	useTestSettings(t, "https://github.example.com/api/v3")
+	repo := repository{Owner: "owner", Name: "repo"}
+	taken := date(2025, 7, 1)
+	if err := writeSnapshot(repo, taken, []octokit.Issue{testIssue(1)}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := readSnapshot(repo, taken); err != nil {
+		t.Fatal(err)
+	}
+
+	settings.APIURL = githubAPIURL
+	_, _, _, err := readSnapshot(repo, taken)
+	if err == nil || !strings.Contains(err.Error(), "holds data from https://github.example.com/api/v3") {
+		t.Errorf("got error %v reading a snapshot from another host", err)
+	}
+	if code := exitCode(err); code != exitCacheFailure {
+		t.Errorf("got exit code %d, want %d", code, exitCacheFailure)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+	_ "modernc.org/sqlite"
+)
+
+// database is the SQLite database given by the --database option, or
+// nil if no database is used. The database mirrors the cache: data is
+// written to it whenever the cache is written, and cached data is read
+// from it unless the cache files are more recent (see readCachedData).
+var database *sql.DB
+
+// storeSchema creates the tables of the database. Each issue and pull
+// request is stored as json (in the data column) so that it can be read
+// back exactly, along with the fields which are most useful in queries.
+// Times are stored as RFC 3339 text in UTC.
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS repositories (
+	name       TEXT PRIMARY KEY,
+	api_url    TEXT NOT NULL,
+	fetched_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS users (
+	login TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS issues (
+	repository TEXT NOT NULL REFERENCES repositories(name),
+	number     INTEGER NOT NULL,
+	title      TEXT NOT NULL,
+	state      TEXT NOT NULL,
+	author     TEXT REFERENCES users(login),
+	assignee   TEXT REFERENCES users(login),
+	milestone  TEXT,
+	comments   INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	closed_at  TEXT,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (repository, number)
+);
+CREATE TABLE IF NOT EXISTS pull_requests (
+	repository TEXT NOT NULL REFERENCES repositories(name),
+	number     INTEGER NOT NULL,
+	title      TEXT NOT NULL,
+	state      TEXT NOT NULL,
+	author     TEXT REFERENCES users(login),
+	assignee   TEXT REFERENCES users(login),
+	comments   INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	closed_at  TEXT,
+	merged_at  TEXT,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (repository, number)
+);
+CREATE TABLE IF NOT EXISTS labels (
+	repository TEXT NOT NULL,
+	issue      INTEGER NOT NULL,
+	name       TEXT NOT NULL,
+	PRIMARY KEY (repository, issue, name)
+);
+CREATE TABLE IF NOT EXISTS links (
+	repository       TEXT NOT NULL REFERENCES repositories(name),
+	issue_repository TEXT NOT NULL,
+	issue            INTEGER NOT NULL,
+	pull_repository  TEXT NOT NULL,
+	pull             INTEGER NOT NULL,
+	source           TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS issues_author ON issues(author);
+CREATE INDEX IF NOT EXISTS pull_requests_author ON pull_requests(author);
+CREATE INDEX IF NOT EXISTS labels_name ON labels(name);
+CREATE INDEX IF NOT EXISTS links_repository ON links(repository);
+`
+
+// openStore opens a SQLite database, creating it and its tables if
+// necessary.
+func openStore(fileName string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", fileName)
+	if err != nil {
+		return nil, cacheError(fileName, err)
+	}
+	if _, err := db.Exec(storeSchema); err != nil {
+		db.Close()
+		return nil, cacheError(fileName, err)
+	}
+	return db, nil
+}
+
+// storeTime formats a time for the database.
+func storeTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// storeOptionalTime formats a time which may be nil for the database.
+func storeOptionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return storeTime(*t)
+}
+
+// storeUser returns the login of a user for the database, or nil if
+// there is no user.
+func storeUser(login string) interface{} {
+	if login == "" {
+		return nil
+	}
+	return login
+}
+
+// storedFetchTime returns the time at which the data for a repository
+// in the database was fetched, and whether the database holds data for
+// the repository.
+func storedFetchTime(db *sql.DB, repo repository, apiURL string) (time.Time, bool, error) {
+	var fetchedAt, storedAPIURL string
+	err := db.QueryRow(`SELECT fetched_at, api_url FROM repositories WHERE name = ?`, repo.String()).Scan(&fetchedAt, &storedAPIURL)
+	if err == sql.ErrNoRows || (err == nil && storedAPIURL != apiURL) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, cacheError(settings.Database, err)
+	}
+	t, err := time.Parse(time.RFC3339, fetchedAt)
+	if err != nil {
+		return time.Time{}, false, cacheError(settings.Database, err)
+	}
+	return t, true, nil
+}
+
+// writeToStore replaces the data for a repository in the database.
+// fetchedAt is the time at which the data was fetched from apiURL.
+func writeToStore(db *sql.DB, repo repository, apiURL string, fetchedAt time.Time, issues []octokit.Issue, pulls []octokit.PullRequest, links []issueLink) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return cacheError(settings.Database, err)
+	}
+	if err := writeRepositoryToStore(tx, repo, apiURL, fetchedAt, issues, pulls, links); err != nil {
+		tx.Rollback()
+		return cacheError(settings.Database, err)
+	}
+	return cacheError(settings.Database, tx.Commit())
+}
+
+// writeRepositoryToStore replaces the data for a repository within a
+// transaction.
+func writeRepositoryToStore(tx *sql.Tx, repo repository, apiURL string, fetchedAt time.Time, issues []octokit.Issue, pulls []octokit.PullRequest, links []issueLink) error {
+	name := repo.String()
+	for _, table := range []string{"labels", "links", "issues", "pull_requests", "repositories"} {
+		column := "repository"
+		if table == "repositories" {
+			column = "name"
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, table, column), name); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO repositories (name, api_url, fetched_at) VALUES (?, ?, ?)`,
+		name, apiURL, storeTime(fetchedAt)); err != nil {
+		return err
+	}
+
+	addUser := func(login string) error {
+		if login == "" {
+			return nil
+		}
+		_, err := tx.Exec(`INSERT OR IGNORE INTO users (login) VALUES (?)`, login)
+		return err
+	}
+	for _, issue := range issues {
+		data, err := json.Marshal(issue)
+		if err != nil {
+			return err
+		}
+		if err := addUser(issue.User.Login); err != nil {
+			return err
+		}
+		if err := addUser(issue.Assignee.Login); err != nil {
+			return err
+		}
+		var milestone interface{}
+		if issue.Milestone.Title != "" {
+			milestone = issue.Milestone.Title
+		}
+		_, err = tx.Exec(`INSERT INTO issues (repository, number, title, state, author, assignee, milestone, comments, created_at, updated_at, closed_at, data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			name, issue.Number, issue.Title, issue.State, storeUser(issue.User.Login), storeUser(issue.Assignee.Login),
+			milestone, issue.Comments, storeTime(issue.CreatedAt), storeTime(issue.UpdatedAt), storeOptionalTime(issue.ClosedAt), string(data))
+		if err != nil {
+			return err
+		}
+		for _, label := range issue.Labels {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO labels (repository, issue, name) VALUES (?, ?, ?)`,
+				name, issue.Number, label.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, pull := range pulls {
+		data, err := json.Marshal(pull)
+		if err != nil {
+			return err
+		}
+		var assignee string
+		if pull.Assignee != nil {
+			assignee = pull.Assignee.Login
+		}
+		if err := addUser(pull.User.Login); err != nil {
+			return err
+		}
+		if err := addUser(assignee); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO pull_requests (repository, number, title, state, author, assignee, comments, created_at, updated_at, closed_at, merged_at, data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			name, pull.Number, pull.Title, pullState(pull), storeUser(pull.User.Login), storeUser(assignee),
+			pull.Comments, storeTime(pull.CreatedAt), storeTime(pull.UpdatedAt), storeOptionalTime(pull.ClosedAt),
+			storeOptionalTime(pull.MergedAt), string(data))
+		if err != nil {
+			return err
+		}
+	}
+	for _, link := range links {
+		_, err := tx.Exec(`INSERT INTO links (repository, issue_repository, issue, pull_repository, pull, source) VALUES (?, ?, ?, ?, ?, ?)`,
+			name, link.IssueRepo, link.Issue, link.PullRepo, link.Pull, link.Source)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFromStore reads the data for a repository from the database.
+func readFromStore(db *sql.DB, repo repository) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error) {
+	name := repo.String()
+	var issues []octokit.Issue
+	err := queryStore(db, `SELECT data FROM issues WHERE repository = ? ORDER BY number DESC`, name, func(rows *sql.Rows) error {
+		var data string
+		var issue octokit.Issue
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(data), &issue); err != nil {
+			return err
+		}
+		issues = append(issues, issue)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var pulls []octokit.PullRequest
+	err = queryStore(db, `SELECT data FROM pull_requests WHERE repository = ? ORDER BY number DESC`, name, func(rows *sql.Rows) error {
+		var data string
+		var pull octokit.PullRequest
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(data), &pull); err != nil {
+			return err
+		}
+		pulls = append(pulls, pull)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var links []issueLink
+	err = queryStore(db, `SELECT issue_repository, issue, pull_repository, pull, source FROM links WHERE repository = ?`, name, func(rows *sql.Rows) error {
+		var link issueLink
+		if err := rows.Scan(&link.IssueRepo, &link.Issue, &link.PullRepo, &link.Pull, &link.Source); err != nil {
+			return err
+		}
+		links = append(links, link)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return issues, pulls, links, nil
+}
+
+// queryStore runs a query on the database with a single argument, and
+// calls scan for each row of the result.
+func queryStore(db *sql.DB, query string, arg interface{}, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query, arg)
+	if err != nil {
+		return cacheError(settings.Database, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return cacheError(settings.Database, err)
+		}
+	}
+	return cacheError(settings.Database, rows.Err())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// useTestStore opens a new database as the store of cached data.
+func useTestStore(t *testing.T) {
+	t.Helper()
+	db, err := openStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := database
+	database = db
+	t.Cleanup(func() {
+		database = saved
+		db.Close()
+	})
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	useTestSettings(t, githubAPIURL)
+	useTestStore(t)
+	repo := repository{Owner: "owner", Name: "repo"}
+	fetchedAt := time.Date(2025, 8, 15, 12, 30, 45, 500, time.UTC)
+	closed := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	issue := labeledIssue("bug", "wheat")
+	issue.Number, issue.Title, issue.State, issue.ClosedAt = 2, "Wheat", "closed", &closed
+	issue.Assignee.Login = "bob"
+	pull := octokit.PullRequest{Number: 3, Title: "Fix wheat", ClosedAt: &closed, MergedAt: &closed}
+	links := []issueLink{{IssueRepo: "owner/repo", Issue: 2, PullRepo: "owner/repo", Pull: 3, Source: linkFromClosedEvent}}
+	if err := writeToStore(database, repo, githubAPIURL, fetchedAt, []octokit.Issue{issue, testIssue(1)}, []octokit.PullRequest{pull}, links); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, pulls, gotLinks, err := readFromStore(database, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(issueNumbers(issues)) != "[2 1]" || issues[0].Assignee.Login != "bob" || len(issues[0].Labels) != 2 ||
+		issues[0].ClosedAt == nil || !issues[0].ClosedAt.Equal(closed) {
+		t.Errorf("got issues %v, want [2 1], with issue 2 closed, assigned to bob and labelled", issueNumbers(issues))
+	}
+	if len(pulls) != 1 || pulls[0].Number != 3 || pullState(pulls[0]) != pullMerged {
+		t.Errorf("got %d pull requests, want merged pull request 3", len(pulls))
+	}
+	if fmt.Sprint(gotLinks) != fmt.Sprint(links) {
+		t.Errorf("got links %v, want %v", gotLinks, links)
+	}
+
+	// Times are stored to the nearest second.
+	stored, ok, err := storedFetchTime(database, repo, githubAPIURL)
+	if err != nil || !ok || !stored.Equal(fetchedAt.Truncate(time.Second)) {
+		t.Errorf("got fetch time %v (%v, %v), want %v", stored, ok, err, fetchedAt.Truncate(time.Second))
+	}
+	if _, ok, err := storedFetchTime(database, repo, "https://github.example.com/api/v3"); ok || err != nil {
+		t.Errorf("the database holds data from another host (%v)", err)
+	}
+
+	// Writing the data again replaces it.
+	if err := writeToStore(database, repo, githubAPIURL, fetchedAt, []octokit.Issue{testIssue(1)}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	issues, pulls, gotLinks, err = readFromStore(database, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(issueNumbers(issues)) != "[1]" || len(pulls) != 0 || len(gotLinks) != 0 {
+		t.Errorf("got issues %v, %d pull requests and %d links after replacing the data, want [1] and none",
+			issueNumbers(issues), len(pulls), len(gotLinks))
+	}
+}
+
+func TestReadCachedDataFromStore(t *testing.T) {
+	repo := repository{Owner: "owner", Name: "repo"}
+	earlier := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	later := time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// The times at which the cache files and the database were
+		// written, if they were.
+		files, stored time.Time
+		storedAPIURL  string
+		// want is the issues read: [1] from the database, or [2 1] from
+		// the cache files. Empty if an error is expected.
+		want string
+	}{
+		{"no cache files", time.Time{}, earlier, githubAPIURL, "[1]"},
+		{"older cache files", earlier, later, githubAPIURL, "[1]"},
+		{"cache files from the same fetch", later, later, githubAPIURL, "[1]"},
+		{"newer cache files", later, earlier, githubAPIURL, "[2 1]"},
+		{"database from another host", later, later, "https://github.example.com/api/v3", "[2 1]"},
+		{"no data", time.Time{}, time.Time{}, githubAPIURL, ""},
+		{"no data from this host", time.Time{}, later, "https://github.example.com/api/v3", ""},
+	}
+	for _, test := range tests {
+		useTestSettings(t, githubAPIURL)
+		useTestStore(t)
+		if !test.files.IsZero() {
+			writeTestCache(t, repo, test.files, testIssue(2), testIssue(1))
+		}
+		if !test.stored.IsZero() {
+			if err := writeToStore(database, repo, test.storedAPIURL, test.stored, []octokit.Issue{testIssue(1)}, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := hasCache("owner", "repo"); got != (test.want != "") {
+			t.Errorf("%s: hasCache = %v", test.name, got)
+		}
+		issues, _, _, err := readCachedData(repo)
+		if test.want == "" {
+			if err == nil || exitCode(err) != exitCacheFailure {
+				t.Errorf("%s: got error %v, want a cache failure", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if fmt.Sprint(issueNumbers(issues)) != test.want {
+			t.Errorf("%s: got issues %v, want %s", test.name, issueNumbers(issues), test.want)
+		}
+		// Data read from the cache files is written to the database.
+		if stored, ok, err := storedFetchTime(database, repo, githubAPIURL); !ok || err != nil || stored.Before(test.files) {
+			t.Errorf("%s: the database holds data fetched at %v (%v, %v), want %v", test.name, stored, ok, err, test.files)
+		}
+	}
+}
@@ -4,21 +4,21 @@ import (
 	"bufio"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/octokit/go-octokit/octokit"
 )
 
 // getAuth reads a file and returns a github authentication method.
-func getAuth(filename string) octokit.AuthMethod {
+func getAuth(filename string) (octokit.AuthMethod, error) {
 	credentials, err := ioutil.ReadFile(filename)
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, withExitCode(exitAuthFailure, fmt.Errorf("unable to read credentials: %w", err))
 	}
 	var username, password string
 	scanner := bufio.NewScanner(strings.NewReader(string(credentials)))
@@ -32,11 +32,29 @@ func getAuth(filename string) octokit.AuthMethod {
 		}
 		if strings.HasPrefix(line, "token=") {
 			token := strings.TrimPrefix(line, "token=")
-			return octokit.TokenAuth{AccessToken: token}
+			return octokit.TokenAuth{AccessToken: token}, nil
 		}
 	}
 
-	return octokit.BasicAuth{Login: username, Password: password}
+	return octokit.BasicAuth{Login: username, Password: password}, nil
+}
+
+// readTeamFile reads a list of github usernames from a file, one per
+// line. Blank lines and lines starting with # are ignored.
+func readTeamFile(filename string) ([]string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read team file: %w", err)
+	}
+	var users []string
+	scanner := bufio.NewScanner(strings.NewReader(string(contents)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			users = append(users, line)
+		}
+	}
+	return users, nil
 }
 
 // sortKeys returns a slice of all keys in a map, sorted in
@@ -195,127 +213,421 @@ func getFirstDate(data map[time.Time]int) time.Time {
 }
 
 // getAllIssues gets all issues (open and closed) on a github
-// repository.
-func getAllIssues(client *octokit.Client, owner, repo string, showProgress bool) (issues []octokit.Issue) {
-	apsimURL := octokit.Hyperlink("repos/{owner}/{repo}/issues?state={state}")
-	first := true
-	var numIssues int
-	for &apsimURL != nil {
-		issuesSubset, result := client.Issues().All(&apsimURL, octokit.M{
-			"owner": owner,
-			"repo":  repo,
-			"state": "all",
-		})
+// repository. If since is not the zero time, only issues updated on or
+// after that time are fetched. Pages are fetched concurrently and
+// checkpointed by fetchAllPages.
+func getAllIssues(client *octokit.Client, owner, repo string, since time.Time, progress *fetchProgress) ([]octokit.Issue, error) {
+	apsimURL := octokit.Hyperlink("repos/{owner}/{repo}/issues{?state,sort,since}")
+	params := octokit.M{
+		"owner": owner,
+		"repo":  repo,
+		"state": "all",
+	}
+	if !since.IsZero() {
+		params["sort"] = "updated"
+		params["since"] = since.UTC().Format(time.RFC3339)
+	}
+	firstURL, err := apsimURL.Expand(params)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchPage := func(url string) (checkpointPage, *octokit.Hyperlink, error) {
+		var page checkpointPage
+		link := octokit.Hyperlink(url)
+		issuesSubset, result := client.Issues().All(&link, octokit.M{})
 		if result.HasError() {
-			panic(result)
+			return page, nil, fmt.Errorf("unable to fetch issues for %s/%s: %w", owner, repo, result.Err)
 		}
 		for _, issue := range issuesSubset {
-			if first && showProgress {
-				fmt.Printf("Updating numIssues to %d\n", issue.Number)
-				numIssues = issue.Number
-				first = false
-			}
-			if showProgress {
-				percentDone := 100.0 * float64(numIssues-issue.Number) / float64(numIssues)
-				fmt.Printf("\rFetching issues: %.2f%%...", percentDone)
-			}
 			if issue.PullRequest.HTMLURL == "" {
-				issues = append(issues, issue)
+				page.Issues = append(page.Issues, issue)
 			}
 		}
-		if result.NextPage == nil {
-			break
-		}
-		apsimURL = *result.NextPage
+		return page, result.LastPage, nil
 	}
-	if showProgress {
-		fmt.Printf("\rFetching issues: 100.00%%...\n")
+	checkpointFile := cacheFileName(owner, repo, issuesCheckpoint)
+	pages, err := fetchAllPages(firstURL.String(), fetchPage, checkpointFile, since, "issues", progress)
+	if err != nil {
+		return nil, err
 	}
-	return
+
+	// If an issue was created while we were fetching, other issues may
+	// have moved onto the next page, and been fetched twice.
+	var issues []octokit.Issue
+	seen := make(map[int]bool)
+	for _, page := range pages {
+		for _, issue := range page.Issues {
+			if !seen[issue.Number] {
+				seen[issue.Number] = true
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues, nil
 }
 
 // getAllPullRequests gets all pull requests (open and closed) on a
-// github repository.
-func getAllPullRequests(client *octokit.Client, owner, repo string, showProgress bool) []octokit.PullRequest {
-	var pulls []octokit.PullRequest
-	apsimURL := octokit.Hyperlink("repos/{owner}/{repo}/pulls?state=closed")
+// github repository. If since is not the zero time, only pull requests
+// updated on or after that time are fetched. Pages are fetched
+// concurrently and checkpointed by fetchAllPages.
+func getAllPullRequests(client *octokit.Client, owner, repo string, since time.Time, progress *fetchProgress) ([]octokit.PullRequest, error) {
+	apsimURL := octokit.Hyperlink("repos/{owner}/{repo}/pulls?state=all")
+
+	// The pulls endpoint has no since parameter, so in incremental mode
+	// we fetch the most recently updated pull requests first, and stop
+	// as soon as we reach one which was last updated before since.
+	incremental := !since.IsZero()
+	if incremental {
+		apsimURL = octokit.Hyperlink("repos/{owner}/{repo}/pulls?state=all&sort=updated&direction=desc")
+	}
+	firstURL, err := apsimURL.Expand(octokit.M{
+		"owner": owner,
+		"repo":  repo,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	first := true
-	var numPullRequests int
-	var percentDone float64
-	for &apsimURL != nil {
-		url, err := apsimURL.Expand(octokit.M{
-			"owner": owner,
-			"repo":  repo,
-		})
+	fetchPage := func(url string) (checkpointPage, *octokit.Hyperlink, error) {
+		var page checkpointPage
+		link := octokit.Hyperlink(url)
+		pageURL, err := link.Expand(octokit.M{})
 		if err != nil {
-			panic(err)
+			return page, nil, err
 		}
-
-		allPulls, result := client.PullRequests(url).All()
+		allPulls, result := client.PullRequests(pageURL).All()
 		if result.HasError() {
-			panic(result)
+			return page, nil, fmt.Errorf("unable to fetch pull requests for %s/%s: %w", owner, repo, result.Err)
 		}
 		for _, pull := range allPulls {
-			if first {
-				numPullRequests = pull.Number
-				first = false
+			if incremental && pull.UpdatedAt.Before(since) {
+				page.Done = true
+				break
 			}
+			page.Pulls = append(page.Pulls, pull)
+		}
+		return page, result.LastPage, nil
+	}
+	checkpointFile := cacheFileName(owner, repo, pullsCheckpoint)
+	pages, err := fetchAllPages(firstURL.String(), fetchPage, checkpointFile, since, "pull requests", progress)
+	if err != nil {
+		return nil, err
+	}
 
-			if showProgress {
-				percentDone = 100.0 * float64(numPullRequests-pull.Number) / float64(numPullRequests)
-				fmt.Printf("\rFetching pull requests: %.2f%%...", percentDone)
+	var pulls []octokit.PullRequest
+	seen := make(map[int]bool)
+	for _, page := range pages {
+		for _, pull := range page.Pulls {
+			if !seen[pull.Number] {
+				seen[pull.Number] = true
+				pulls = append(pulls, pull)
 			}
-
-			pulls = append(pulls, pull)
 		}
-		if result.NextPage == nil {
-			break
-		}
-		apsimURL = *result.NextPage
-	}
-	if showProgress {
-		fmt.Printf("\rFetching pull requests: 100.00%%...\n")
 	}
-	return pulls
+	return pulls, nil
 }
 
 // getDataFromGithub gets all issues and pull requests on a github
-// repository by calling the github API.
-func getDataFromGithub(client *octokit.Client, owner, repo string, showProgress bool) (issues []octokit.Issue, pulls []octokit.PullRequest) {
-	// TODO : combine these methods.
-	issues = getAllIssues(client, owner, repo, showProgress)
-	pulls = getAllPullRequests(client, owner, repo, showProgress)
+// repository by calling the github API. Issues and pull requests are
+// fetched concurrently. If since is not the zero time, only issues and
+// pull requests updated since then are fetched.
+func getDataFromGithub(client *octokit.Client, owner, repo string, since time.Time, showProgress bool) (issues []octokit.Issue, pulls []octokit.PullRequest, err error) {
+	progress := newFetchProgress(showProgress)
+	var issuesErr, pullsErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		issues, issuesErr = getAllIssues(client, owner, repo, since, progress)
+	}()
+	go func() {
+		defer wg.Done()
+		pulls, pullsErr = getAllPullRequests(client, owner, repo, since, progress)
+	}()
+	wg.Wait()
+	progress.finish()
+
+	if issuesErr != nil {
+		return nil, nil, issuesErr
+	}
+	if pullsErr != nil {
+		return nil, nil, pullsErr
+	}
+	return issues, pulls, nil
+}
+
+// getData gets all data for a list of repositories. Issues and pull
+// requests from all repositories are returned together; use
+// issueRepository and pullRepository to find the source repository of
+// each one. Also returns the links between issues and the pull requests
+// which fixed them, if the fetch backend provides these. The fetcher
+// may be nil if all data is to be read from the cache. If asOf is not
+// the zero time, the data is read from the latest snapshots taken
+// before then (see --as-of).
+func getData(f fetcher, repos []repository, asOf time.Time) (issues []octokit.Issue, pulls []octokit.PullRequest, links []issueLink, err error) {
+	for _, repo := range repos {
+		repoIssues, repoPulls, repoLinks, err := getRepositoryData(f, repo.Owner, repo.Name, asOf)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		issues = append(issues, repoIssues...)
+		pulls = append(pulls, repoPulls...)
+		links = append(links, repoLinks...)
+	}
 	return
 }
 
-// getData gets all data. Will attempt use the cache if the useCache
-// global is set to true. Will get the data from github otherwise.
-func getData(client *octokit.Client) ([]octokit.Issue, []octokit.PullRequest) {
-	// Only use cache if cache files are available.
-	if settings.UseCache && fileExists(issuesCache) && fileExists(pullsCache) {
-		fmt.Println("Fetching data from cache. This data is not live...")
-		return getDataFromCache(issuesCache, pullsCache)
+// getRepositoryData gets all data for a repository. Will attempt use the
+// cache if the useCache global is set to true. Will get the data from
+// github otherwise, and store it as a snapshot. If asOf is not the zero
+// time, the data is read from the latest snapshot taken before then
+// instead.
+func getRepositoryData(f fetcher, owner, repo string, asOf time.Time) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error) {
+	issuesFile := cacheFileName(owner, repo, issuesCache)
+	pullsFile := cacheFileName(owner, repo, pullsCache)
+	linksFile := cacheFileName(owner, repo, linksCache)
+	metadataFile := cacheFileName(owner, repo, metadataCache)
+	ownerRepo := repository{Owner: owner, Name: repo}
+
+	if !asOf.IsZero() {
+		taken, err := findSnapshot(ownerRepo, settings.AsOf, asOf)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !settings.Quiet {
+			fmt.Printf("Using the snapshot of %s/%s taken at %s...\n", owner, repo, taken.Local().Format(time.RFC1123))
+		}
+		return readSnapshot(ownerRepo, taken)
+	}
+
+	// Only use cache if cached data is available.
+	if settings.UseCache && hasCache(owner, repo) {
+		fmt.Printf("Fetching data for %s/%s from cache. This data is not live...\n", owner, repo)
+		return readCachedData(ownerRepo)
+	}
+
+	// In incremental mode, only fetch data which has changed since the
+	// last sync. This requires a complete cache from a previous run, from
+	// the same github host. Otherwise, all data is fetched and replaces
+	// the cache.
+	var since time.Time
+	if settings.Incremental && fileExists(issuesFile) && fileExists(pullsFile) && fileExists(metadataFile) {
+		metadata, err := metadataFromCache(metadataFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		switch {
+		case defaultAPIURL(metadata.APIURL) != settings.apiURL():
+			if !settings.Quiet {
+				fmt.Printf("Cached data for %s/%s was fetched from %s; fetching all data from %s...\n",
+					owner, repo, defaultAPIURL(metadata.APIURL), settings.apiURL())
+			}
+		case !cacheWrittenAt(ownerRepo, metadata.LastSync):
+			if !settings.Quiet {
+				fmt.Printf("Cached data for %s/%s is incomplete; fetching all data...\n", owner, repo)
+			}
+		default:
+			since = metadata.LastSync
+		}
+	}
+
+	// Record the time before fetching anything, so that items updated
+	// while we are fetching are picked up again by the next sync. If the
+	// fetch resumes from checkpoints, their pages were fetched earlier,
+	// so the time of the earliest of these is recorded instead.
+	var lastSync time.Time
+	if metadata, err := metadataFromCache(metadataFile); err == nil {
+		lastSync = metadata.LastSync
 	}
+	checkpointFiles := []string{cacheFileName(owner, repo, issuesCheckpoint), cacheFileName(owner, repo, pullsCheckpoint)}
+	syncTime, err := resumeCheckpoints(checkpointFiles, since, settings.apiURL(), lastSync, time.Now())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	// Only show progress if not in quiet mode.
-	issues, pulls := getDataFromGithub(client, owner, repo, !settings.Quiet)
+	issues, pulls, links, err := f.fetch(owner, repo, since, !settings.Quiet)
+	if err != nil {
+		return nil, nil, nil, fetchError(err)
+	}
+	if !since.IsZero() {
+		var cachedLinks []issueLink
+		if fileExists(linksFile) {
+			cachedLinks, err = linksFromCache(linksFile, ownerRepo, since)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		cachedIssues, cachedPulls, err := getDataFromCache(issuesFile, pullsFile, ownerRepo, since)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		links = mergeLinks(cachedLinks, links, issues, pulls)
+		issues = mergeIssues(cachedIssues, issues)
+		pulls = mergePullRequests(cachedPulls, pulls)
+	}
 
 	// Update cache for next time.
-	writeToCache(pullsCache, pulls)
-	writeIssuesToCache(issuesCache, issues)
+	header := newCacheHeader(ownerRepo, syncTime)
+	if err := writeToCache(pullsFile, header, pulls); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := writeIssuesToCache(issuesFile, header, issues); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := writeLinksToCache(linksFile, header, links); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := writeMetadataToCache(metadataFile, cacheMetadata{LastSync: syncTime, APIURL: settings.apiURL()}); err != nil {
+		return nil, nil, nil, err
+	}
+	if database != nil {
+		if err := writeToStore(database, ownerRepo, settings.apiURL(), syncTime, issues, pulls, links); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if !settings.NoSnapshot {
+		if err := writeSnapshot(ownerRepo, syncTime, issues, pulls, links); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := pruneSnapshots(ownerRepo, settings.KeepSnaps); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// The cache is now complete, so the checkpoints are no longer needed.
+	for _, checkpointFile := range checkpointFiles {
+		if err := removeCheckpoint(checkpointFile); err != nil {
+			return nil, nil, nil, cacheError(checkpointFile, err)
+		}
+	}
 
-	return issues, pulls
+	return issues, pulls, links, nil
 }
 
-// fileExists checks if a file exists
-func fileExists(fileName string) bool {
-	if _, err := os.Stat(fileName); err == nil {
+// readCachedData reads the cached data for a repository. Data from
+// different github hosts must never be mixed, so the data must have been
+// fetched from the API URL given by the user. If a database is used (see
+// --database) and holds data for the repository which is at least as
+// recent as the cache files (or there are no usable cache files), the
+// data is read from the database. Otherwise, it is read from the cache
+// files, and written to the database.
+func readCachedData(repo repository) ([]octokit.Issue, []octokit.PullRequest, []issueLink, error) {
+	apiURL := settings.apiURL()
+	var fileURL string
+	var lastSync time.Time
+	haveFiles := hasCacheFiles(repo.Owner, repo.Name)
+	if haveFiles {
+		metadataFile := cacheFileName(repo.Owner, repo.Name, metadataCache)
+		var err error
+		if fileURL, err = cachedAPIURL(metadataFile); err != nil {
+			return nil, nil, nil, err
+		}
+		if fileExists(metadataFile) {
+			metadata, err := metadataFromCache(metadataFile)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			lastSync = metadata.LastSync
+		}
+	}
+	if database != nil {
+		fetchedAt, ok, err := storedFetchTime(database, repo, apiURL)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		// Times are stored in the database to the nearest second.
+		if ok && (!haveFiles || fileURL != apiURL || !fetchedAt.Before(lastSync.Truncate(time.Second))) {
+			return readFromStore(database, repo)
+		}
+	}
+	if !haveFiles {
+		return nil, nil, nil, withExitCode(exitCacheFailure, fmt.Errorf("no cached data for %s", repo))
+	}
+	if fileURL != apiURL {
+		return nil, nil, nil, withExitCode(exitCacheFailure, fmt.Errorf(
+			"cached data for %s was fetched from %s, not %s; rerun without --use-cache to replace it",
+			repo, fileURL, apiURL))
+	}
+
+	issues, pulls, err := getDataFromCache(
+		cacheFileName(repo.Owner, repo.Name, issuesCache),
+		cacheFileName(repo.Owner, repo.Name, pullsCache), repo, lastSync)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var links []issueLink
+	linksFile := cacheFileName(repo.Owner, repo.Name, linksCache)
+	if fileExists(linksFile) {
+		links, err = linksFromCache(linksFile, repo, lastSync)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if database != nil {
+		if err := writeToStore(database, repo, apiURL, lastSync, issues, pulls, links); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return issues, pulls, links, nil
+}
+
+// cacheWrittenAt checks if the cached issues, pull requests and links
+// (if any) of a repository were all written by the fetch at lastSync
+// (see cacheHeader.writtenAt).
+func cacheWrittenAt(repo repository, lastSync time.Time) bool {
+	for _, kind := range []string{issuesCache, pullsCache, linksCache} {
+		fileName := cacheFileName(repo.Owner, repo.Name, kind)
+		if kind == linksCache && !fileExists(fileName) {
+			continue
+		}
+		header, err := readCacheHeader(fileName, kind, repo)
+		if err != nil || !header.writtenAt(lastSync) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCache checks if the cache contains data for a repository, either
+// in the cache files or in the database (if one is used, see
+// --database). If the database can't be read, the data is assumed to
+// be cached, so that the error is reported when it is read.
+func hasCache(owner, repo string) bool {
+	if hasCacheFiles(owner, repo) {
 		return true
-	} else if os.IsNotExist(err) {
+	}
+	if database == nil {
 		return false
-	} else {
-		panic(fmt.Sprintf("Error: Unable to determine if file '%s' exists", fileName))
 	}
+	_, ok, err := storedFetchTime(database, repository{Owner: owner, Name: repo}, settings.apiURL())
+	return ok || err != nil
+}
+
+// hasCacheFiles checks if the cache files hold data for a repository.
+func hasCacheFiles(owner, repo string) bool {
+	return fileExists(cacheFileName(owner, repo, issuesCache)) &&
+		fileExists(cacheFileName(owner, repo, pullsCache))
+}
+
+// allCached checks if the cache contains data for all of a list of
+// repositories.
+func allCached(repos []repository) bool {
+	for _, repo := range repos {
+		if !hasCache(repo.Owner, repo.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileExists checks if a file exists. If this can't be determined
+// (e.g. due to a permissions error), the file is assumed to exist, so
+// that the error is reported when the file is opened.
+func fileExists(fileName string) bool {
+	_, err := os.Stat(fileName)
+	return !os.IsNotExist(err)
 }
 
 // filterIssues returns a deep clone of a slice of issues, filtered on
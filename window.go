@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octokit/go-octokit/octokit"
+)
+
+// dateWindow is the range of dates which is reported on, given by the
+// --since and --until options.
+type dateWindow struct {
+	// since is the start of the window.
+	since time.Time
+	// until is the (exclusive) end of the window. The window is open
+	// ended if this is the zero time.
+	until time.Time
+}
+
+// contains checks if a time is within the window.
+func (w dateWindow) contains(t time.Time) bool {
+	return !t.Before(w.since) && (w.until.IsZero() || t.Before(w.until))
+}
+
+// String describes the window, e.g. "since 1/1/2020".
+func (w dateWindow) String() string {
+	if w.until.IsZero() {
+		return fmt.Sprintf("since %s", w.since.Format("2/1/2006"))
+	}
+	// The end of the window is exclusive, so describe the window in
+	// terms of the last day it contains.
+	last := w.until.Add(-time.Nanosecond)
+	return fmt.Sprintf("from %s to %s", w.since.Format("2/1/2006"), last.Format("2/1/2006"))
+}
+
+// issuesAsOf returns issues as they were at the end of the window:
+// issues created after the end are removed, and issues closed after the
+// end are treated as open.
+func (w dateWindow) issuesAsOf(issues []octokit.Issue) []octokit.Issue {
+	if w.until.IsZero() {
+		return issues
+	}
+	var result []octokit.Issue
+	for _, issue := range issues {
+		if !issue.CreatedAt.Before(w.until) {
+			continue
+		}
+		if issue.ClosedAt != nil && !issue.ClosedAt.Before(w.until) {
+			issue.ClosedAt = nil
+		}
+		result = append(result, issue)
+	}
+	return result
+}
+
+// pullsAsOf returns pull requests as they were at the end of the window:
+// pull requests created after the end are removed, and pull requests
+// closed or merged after the end are treated as open.
+func (w dateWindow) pullsAsOf(pulls []octokit.PullRequest) []octokit.PullRequest {
+	if w.until.IsZero() {
+		return pulls
+	}
+	var result []octokit.PullRequest
+	for _, pull := range pulls {
+		if !pull.CreatedAt.Before(w.until) {
+			continue
+		}
+		if pull.ClosedAt != nil && !pull.ClosedAt.Before(w.until) {
+			pull.ClosedAt = nil
+			pull.MergedAt = nil
+		}
+		result = append(result, pull)
+	}
+	return result
+}
+
+// Window semantics, which determine which issues and pull requests are
+// counted by a report metric.
+const (
+	// windowCreated selects items created within the window.
+	windowCreated = "created"
+	// windowClosed selects items closed within the window.
+	windowClosed = "closed"
+	// windowActive selects items which were open at any time during the
+	// window.
+	windowActive = "active"
+)
+
+// windowSemantics lists all window semantics.
+var windowSemantics = []string{windowCreated, windowClosed, windowActive}
+
+// selects checks if an item created and closed at the given times is
+// selected by the window, under the given semantics. closedAt is nil
+// if the item is open.
+func (w dateWindow) selects(semantics string, createdAt time.Time, closedAt *time.Time) bool {
+	switch semantics {
+	case windowClosed:
+		return closedAt != nil && w.contains(*closedAt)
+	case windowActive:
+		return (w.until.IsZero() || createdAt.Before(w.until)) && (closedAt == nil || !closedAt.Before(w.since))
+	default:
+		return w.contains(createdAt)
+	}
+}
+
+// selectIssues returns the issues selected by the window under the given
+// semantics, as they were at the end of the window.
+func (w dateWindow) selectIssues(issues []octokit.Issue, semantics string) []octokit.Issue {
+	return filterIssues(w.issuesAsOf(issues), func(issue octokit.Issue) bool {
+		return w.selects(semantics, issue.CreatedAt, issue.ClosedAt)
+	})
+}
+
+// selectPulls returns the pull requests selected by the window under the
+// given semantics, as they were at the end of the window.
+func (w dateWindow) selectPulls(pulls []octokit.PullRequest, semantics string) []octokit.PullRequest {
+	return filterPullRequests(w.pullsAsOf(pulls), func(pull octokit.PullRequest) bool {
+		return w.selects(semantics, pull.CreatedAt, pull.ClosedAt)
+	})
+}
+
+// mergedPulls returns the pull requests merged within the window.
+func (w dateWindow) mergedPulls(pulls []octokit.PullRequest) []octokit.PullRequest {
+	return filterPullRequests(pulls, func(pull octokit.PullRequest) bool {
+		return pull.MergedAt != nil && w.contains(*pull.MergedAt)
+	})
+}
+
+var (
+	relativeDateRx = regexp.MustCompile(`^(\d+)([dwmy])$`)
+	quarterRx      = regexp.MustCompile(`^(\d{4})-[Qq]([1-4])$`)
+)
+
+// parseDateRange parses a date expression, and returns the range of
+// time which it refers to. The range starts at start (inclusive) and
+// ends at end (exclusive). The following expressions are accepted:
+//   - d/m/yyyy, yyyy-mm-dd: a day
+//   - yyyy-mm: a month
+//   - yyyy: a year
+//   - yyyy-Qn: a quarter, e.g. 2025-Q3
+//   - an RFC 3339 time, e.g. 2025-07-01T09:00:00Z: an instant
+//   - Nd, Nw, Nm, Ny: the instant N days, weeks, months or years ago
+//   - today, yesterday
+//   - this-month, last-month, this-quarter, last-quarter, this-year,
+//     last-year
+//
+// Dates are in UTC. Relative expressions are relative to now.
+func parseDateRange(expr string, now time.Time) (start, end time.Time, err error) {
+	expr = strings.TrimSpace(expr)
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	thisQuarter := time.Date(now.Year(), now.Month()-(now.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	thisYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+
+	switch strings.ToLower(expr) {
+	case "today":
+		return today, today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	case "this-month":
+		return thisMonth, thisMonth.AddDate(0, 1, 0), nil
+	case "last-month":
+		return thisMonth.AddDate(0, -1, 0), thisMonth, nil
+	case "this-quarter":
+		return thisQuarter, thisQuarter.AddDate(0, 3, 0), nil
+	case "last-quarter":
+		return thisQuarter.AddDate(0, -3, 0), thisQuarter, nil
+	case "this-year":
+		return thisYear, thisYear.AddDate(1, 0, 0), nil
+	case "last-year":
+		return thisYear.AddDate(-1, 0, 0), thisYear, nil
+	}
+
+	if match := relativeDateRx.FindStringSubmatch(expr); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return start, end, fmt.Errorf("invalid date '%s'", expr)
+		}
+		switch match[2] {
+		case "d":
+			start = now.AddDate(0, 0, -n)
+		case "w":
+			start = now.AddDate(0, 0, -7*n)
+		case "m":
+			start = now.AddDate(0, -n, 0)
+		case "y":
+			start = now.AddDate(-n, 0, 0)
+		}
+		return start, start, nil
+	}
+	if match := quarterRx.FindStringSubmatch(expr); match != nil {
+		year, _ := strconv.Atoi(match[1])
+		quarter, _ := strconv.Atoi(match[2])
+		start = time.Date(year, time.Month(3*quarter-2), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 3, 0), nil
+	}
+	if t, err := time.Parse("2/1/2006", expr); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse("2006-01-02", expr); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse("2006-01", expr); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if t, err := time.Parse("2006", expr); err == nil {
+		return t, t.AddDate(1, 0, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, expr); err == nil {
+		return t, t, nil
+	}
+	return start, end, fmt.Errorf("invalid date '%s' (expected e.g. 2025-07-01, 1/7/2025, 2025-Q3, 90d or last-quarter)", expr)
+}
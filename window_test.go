@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testNow is the current time in tests of relative dates.
+var testNow = time.Date(2025, 8, 15, 12, 30, 0, 0, time.UTC)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseDateRange(t *testing.T) {
+	tests := []struct {
+		expr       string
+		start, end time.Time
+	}{
+		{"1/7/2025", date(2025, 7, 1), date(2025, 7, 2)},
+		{"31/12/2024", date(2024, 12, 31), date(2025, 1, 1)},
+		{"2025-07-01", date(2025, 7, 1), date(2025, 7, 2)},
+		{" 2025-07-01 ", date(2025, 7, 1), date(2025, 7, 2)},
+		{"2025-07", date(2025, 7, 1), date(2025, 8, 1)},
+		{"2024-12", date(2024, 12, 1), date(2025, 1, 1)},
+		{"2025", date(2025, 1, 1), date(2026, 1, 1)},
+		{"2025-Q1", date(2025, 1, 1), date(2025, 4, 1)},
+		{"2025-q3", date(2025, 7, 1), date(2025, 10, 1)},
+		{"2024-Q4", date(2024, 10, 1), date(2025, 1, 1)},
+		{"2025-07-01T09:00:00Z", time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC), time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC)},
+		{"90d", testNow.AddDate(0, 0, -90), testNow.AddDate(0, 0, -90)},
+		{"2w", testNow.AddDate(0, 0, -14), testNow.AddDate(0, 0, -14)},
+		{"6m", testNow.AddDate(0, -6, 0), testNow.AddDate(0, -6, 0)},
+		{"1y", testNow.AddDate(-1, 0, 0), testNow.AddDate(-1, 0, 0)},
+		{"0d", testNow, testNow},
+		{"today", date(2025, 8, 15), date(2025, 8, 16)},
+		{"Yesterday", date(2025, 8, 14), date(2025, 8, 15)},
+		{"this-month", date(2025, 8, 1), date(2025, 9, 1)},
+		{"last-month", date(2025, 7, 1), date(2025, 8, 1)},
+		{"this-quarter", date(2025, 7, 1), date(2025, 10, 1)},
+		{"last-quarter", date(2025, 4, 1), date(2025, 7, 1)},
+		{"this-year", date(2025, 1, 1), date(2026, 1, 1)},
+		{"LAST-YEAR", date(2024, 1, 1), date(2025, 1, 1)},
+	}
+	for _, test := range tests {
+		start, end, err := parseDateRange(test.expr, testNow)
+		if err != nil {
+			t.Errorf("parseDateRange(%q): %v", test.expr, err)
+			continue
+		}
+		if !start.Equal(test.start) || !end.Equal(test.end) {
+			t.Errorf("parseDateRange(%q) = %v to %v, want %v to %v", test.expr, start, end, test.start, test.end)
+		}
+	}
+
+	// Quarters are relative to the current quarter, even in January.
+	start, end, err := parseDateRange("last-quarter", date(2025, 1, 10))
+	if err != nil || !start.Equal(date(2024, 10, 1)) || !end.Equal(date(2025, 1, 1)) {
+		t.Errorf("parseDateRange(last-quarter) in January = %v to %v (%v), want Q4 of the previous year", start, end, err)
+	}
+}
+
+func TestParseDateRangeErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"yesterday-ish",
+		"next-month",
+		"2025-Q5",
+		"2025-Q0",
+		"2025-13",
+		"32/1/2025",
+		"2025-02-30",
+		"1/13/2025",
+		"90",
+		"d",
+		"-90d",
+		"90h",
+		"99999999999999999999d",
+		"2025-07-01T09:00:00",
+	} {
+		if start, end, err := parseDateRange(expr, testNow); err == nil {
+			t.Errorf("parseDateRange(%q) = %v to %v, want an error", expr, start, end)
+		}
+	}
+}
+
+func TestOptionsWindow(t *testing.T) {
+	tests := []struct {
+		since, until string
+		want         dateWindow
+	}{
+		{"1/1/2020", "", dateWindow{since: date(2020, 1, 1)}},
+		{"2025-Q1", "2025-Q2", dateWindow{since: date(2025, 1, 1), until: date(2025, 7, 1)}},
+		{"2025-07-01", "2025-07-01", dateWindow{since: date(2025, 7, 1), until: date(2025, 7, 2)}},
+		{"90d", "today", dateWindow{since: testNow.AddDate(0, 0, -90), until: date(2025, 8, 16)}},
+	}
+	for _, test := range tests {
+		o := options{Date: test.since, UntilDate: test.until}
+		got, err := o.window(testNow)
+		if err != nil {
+			t.Errorf("--since %s --until %s: %v", test.since, test.until, err)
+			continue
+		}
+		if !got.since.Equal(test.want.since) || !got.until.Equal(test.want.until) {
+			t.Errorf("--since %s --until %s: got %v to %v, want %v to %v",
+				test.since, test.until, got.since, got.until, test.want.since, test.want.until)
+		}
+	}
+
+	for _, test := range []struct{ since, until string }{
+		{"invalid", ""},
+		{"2025-01-01", "invalid"},
+		{"2025-07-01", "2025-06"},
+		{"2025", "2024"},
+		{"today", "yesterday"},
+	} {
+		o := options{Date: test.since, UntilDate: test.until}
+		if _, err := o.window(testNow); err == nil {
+			t.Errorf("--since %s --until %s: expected an error", test.since, test.until)
+		}
+	}
+}
+
+func TestDateWindowContains(t *testing.T) {
+	w := dateWindow{since: date(2025, 1, 1), until: date(2025, 2, 1)}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{date(2024, 12, 31), false},
+		{date(2025, 1, 1), true},
+		{date(2025, 1, 31), true},
+		{date(2025, 2, 1), false},
+	}
+	for _, test := range tests {
+		if got := w.contains(test.t); got != test.want {
+			t.Errorf("%v contains %v = %v, want %v", w, test.t, got, test.want)
+		}
+	}
+	if open := (dateWindow{since: date(2025, 1, 1)}); !open.contains(date(2100, 1, 1)) {
+		t.Error("an open ended window doesn't contain a date after its start")
+	}
+}
+
+func TestDateWindowSelects(t *testing.T) {
+	w := dateWindow{since: date(2025, 1, 1), until: date(2025, 2, 1)}
+	before, during, after := date(2024, 12, 1), date(2025, 1, 15), date(2025, 3, 1)
+	tests := []struct {
+		createdAt time.Time
+		closedAt  *time.Time
+		// Whether the item is selected under the created, closed and
+		// active semantics.
+		created, closed, active bool
+	}{
+		{before, nil, false, false, true},
+		{before, &before, false, false, false},
+		{before, &during, false, true, true},
+		{before, &after, false, false, true},
+		{during, nil, true, false, true},
+		{during, &during, true, true, true},
+		{during, &after, true, false, true},
+		{after, nil, false, false, false},
+		{after, &after, false, false, false},
+	}
+	for _, test := range tests {
+		for _, semantics := range []struct {
+			name string
+			want bool
+		}{{windowCreated, test.created}, {windowClosed, test.closed}, {windowActive, test.active}} {
+			if got := w.selects(semantics.name, test.createdAt, test.closedAt); got != semantics.want {
+				t.Errorf("item created %v and closed %v: selected under %s semantics = %v, want %v",
+					test.createdAt, test.closedAt, semantics.name, got, semantics.want)
+			}
+		}
+	}
+}